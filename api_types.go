@@ -1,5 +1,11 @@
 package main
 
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
 type applicationObj struct {
 	ID    snowflake `json:"id"`
 	Flags int       `json:"flags"`
@@ -23,7 +29,7 @@ type messageObj struct {
 	// MentionRoles	array of role object ids	`json:"mention_roles"`	// roles specifically mentioned in this message
 	// MentionChannels	array of channel mention objects	`json:"mention_channels?****"`	// channels specifically mentioned in this message
 	// Attachments	array of attachment objects	`json:"attachments"`	// any attached files
-	// Embeds	array of embed objects	`json:"embeds"`	// any embedded content
+	Embeds []embedObj `json:"embeds"` // any embedded content
 	// Reactions	array of reaction objects	`json:"reactions?"`	// reactions to the message
 	Nonce     string     `json:"nonce"`      // used for validating a message was sent
 	Pinned    bool       `json:"pinned"`     // whether this message is pinned
@@ -37,14 +43,65 @@ type messageObj struct {
 	// ReferencedMessage	message object	`json:"referenced_message?*****"`	// the message associated with the message_reference
 	// Interaction	*message interaction object	`json:"interaction"`	// sent if the message is a response to an Interaction
 	// Thread	*channel object	`json:"thread"`	// the thread that was started from this message, includes thread member object
-	// Components	*Array of message components	`json:"components"`	// sent if the message contains components like buttons, action rows, or other interactive components
+	Components []componentObj `json:"components"` // sent if the message contains components like buttons, action rows, or other interactive components
 	// StickerItems	*array of message sticker item objects	`json:"sticker_items"`	// sent if the message contains stickers
 	// Stickers?	array of sticker objects	`json:"stickers?"`	// Deprecated the stickers sent with the message
 }
 
+// https://discord.com/developers/docs/resources/channel#embed-object
+type embedObj struct {
+	Title       string          `json:"title,omitempty"`       // title of embed
+	Description string          `json:"description,omitempty"` // description of embed
+	URL         string          `json:"url,omitempty"`         // url of embed
+	Timestamp   string          `json:"timestamp,omitempty"`   // ISO8601 timestamp of embed content
+	Color       int             `json:"color,omitempty"`       // color code of the embed
+	Footer      *embedFooterObj `json:"footer,omitempty"`      // footer information
+	Thumbnail   *embedImageObj  `json:"thumbnail,omitempty"`   // thumbnail information
+	Author      *embedAuthorObj `json:"author,omitempty"`      // author information
+	Fields      []embedFieldObj `json:"fields,omitempty"`      // fields information, max of 25
+}
+
+// https://discord.com/developers/docs/resources/channel#embed-object-embed-footer-structure
+type embedFooterObj struct {
+	Text    string `json:"text"`               // footer text
+	IconURL string `json:"icon_url,omitempty"` // url of footer icon (only supports http(s) and attachments)
+}
+
+// https://discord.com/developers/docs/resources/channel#embed-object-embed-thumbnail-structure
+type embedImageObj struct {
+	URL string `json:"url"` // source url of the image (only supports http(s) and attachments)
+}
+
+// https://discord.com/developers/docs/resources/channel#embed-object-embed-author-structure
+type embedAuthorObj struct {
+	Name    string `json:"name"`               // name of author
+	URL     string `json:"url,omitempty"`      // url of author (only supports http(s))
+	IconURL string `json:"icon_url,omitempty"` // url of author icon (only supports http(s) and attachments)
+}
+
+// https://discord.com/developers/docs/resources/channel#embed-object-embed-field-structure
+type embedFieldObj struct {
+	Name   string `json:"name"`             // name of the field
+	Value  string `json:"value"`            // value of the field
+	Inline bool   `json:"inline,omitempty"` // whether or not this field should display inline
+}
+
+// https://discord.com/developers/docs/resources/webhook#webhook-object
+type webhookObj struct {
+	ID            snowflake  `json:"id"`             // the id of the webhook
+	Type          int        `json:"type"`           // the type of the webhook
+	GuildID       *snowflake `json:"guild_id"`       // the guild id this webhook is for, if any
+	ChannelID     *snowflake `json:"channel_id"`     // the channel id this webhook is for, if any
+	User          *userObj   `json:"user"`           // the user this webhook was created by
+	Name          *string    `json:"name"`           // the default name of the webhook
+	Token         string     `json:"token"`          // the secure token of the webhook (returned for Incoming Webhooks)
+	ApplicationID *snowflake `json:"application_id"` // the bot/OAuth2 application that created this webhook
+}
+
 type userObj struct {
 	ID            snowflake `json:"id"`            // the user's id
 	Username      string    `json:"username"`      // the user's username, not unique across the platform
+	GlobalName    *string   `json:"global_name"`   // the user's display name, if it is set
 	Discriminator string    `json:"discriminator"` // the user's 4-digit discord-tag
 	Avatar        string    `json:"avatar"`        // the user's avatar hash
 	Bot           *bool     `json:"bot"`           // whether the user belongs to an OAuth2 application
@@ -62,6 +119,313 @@ type userObj struct {
 
 // https://discord.com/developers/docs/resources/channel#channel-object
 type channelObj struct {
-	ID   snowflake `json:"id"`   // the id of this channel
-	Name string    `json:"name"` // the name of the channel (1-100 characters)
+	ID                   snowflake      `json:"id"`                    // the id of this channel
+	Type                 int            `json:"type"`                  // the type of channel
+	GuildID              *snowflake     `json:"guild_id"`              // the id of the guild (may be missing for some channel objects received over gateway guild dispatches)
+	Position             int            `json:"position"`              // sorting position of the channel
+	PermissionOverwrites []overwriteObj `json:"permission_overwrites"` // explicit permission overwrites for members and roles
+	Name                 string         `json:"name"`                  // the name of the channel (1-100 characters)
+	Topic                *string        `json:"topic"`                 // the channel topic (0-1024 characters)
+	ParentID             *snowflake     `json:"parent_id"`             // for guild channels: id of the parent category for a channel
+}
+
+// https://discord.com/developers/docs/resources/channel#overwrite-object
+type overwriteObj struct {
+	ID    snowflake     `json:"id"`    // role or user id
+	Type  int           `json:"type"`  // either 0 (role) or 1 (member)
+	Allow permissionSet `json:"allow"` // permission bit set
+	Deny  permissionSet `json:"deny"`  // permission bit set
+}
+
+// https://discord.com/developers/docs/resources/guild#guild-object
+type guildObj struct {
+	ID          snowflake `json:"id"`          // guild id
+	Name        string    `json:"name"`        // guild name (2-100 characters, excluding trailing and leading whitespace)
+	OwnerID     snowflake `json:"owner_id"`    // id of owner
+	Roles       []roleObj `json:"roles"`       // roles in the guild
+	Unavailable bool      `json:"unavailable"` // true if this guild is unavailable due to an outage
+}
+
+// https://discord.com/developers/docs/resources/guild#unavailable-guild-object
+type unavailableGuildObj struct {
+	ID          snowflake `json:"id"`
+	Unavailable bool      `json:"unavailable"`
+}
+
+// https://discord.com/developers/docs/topics/permissions#role-object
+type roleObj struct {
+	ID          snowflake     `json:"id"`          // role id
+	Name        string        `json:"name"`        // role name
+	Color       int           `json:"color"`       // integer representation of hexadecimal color code
+	Position    int           `json:"position"`    // position of this role
+	Permissions permissionSet `json:"permissions"` // permission bit set
+	Managed     bool          `json:"managed"`     // whether this role is managed by an integration
+	Mentionable bool          `json:"mentionable"` // whether this role is mentionable
+}
+
+// https://discord.com/developers/docs/resources/guild#guild-member-object
+type guildMemberObj struct {
+	User        *userObj       `json:"user"`        // the user this guild member represents
+	Nick        *string        `json:"nick"`        // this user's guild nickname
+	Roles       []snowflake    `json:"roles"`       // array of role object ids
+	JoinedAt    string         `json:"joined_at"`   // when the user joined the guild
+	Pending     bool           `json:"pending"`     // whether the user has not yet passed the guild's Membership Screening requirements
+	Permissions *permissionSet `json:"permissions"` // total permissions of the member in the channel, only in interactions
+}
+
+// https://discord.com/developers/docs/topics/permissions#permissions-bitwise-permission-flags
+const (
+	PERMISSION_ADMINISTRATOR = 1 << 3
+	PERMISSION_MANAGE_GUILD  = 1 << 5
+	PERMISSION_VIEW_CHANNEL  = 1 << 10
+	PERMISSION_SEND_MESSAGES = 1 << 11
+	PERMISSION_ALL           = ^permissionSet(0)
+)
+
+// permissionSet is serialized as a string as it may not fit in a JSON number
+type permissionSet uint64
+
+func (p *permissionSet) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("parsing permissions %q: %w", s, err)
+	}
+	*p = permissionSet(v)
+	return nil
+}
+
+func (p permissionSet) MarshalJSON() ([]byte, error) {
+	return json.Marshal(strconv.FormatUint(uint64(p), 10))
+}
+
+// https://discord.com/developers/docs/interactions/application-commands#application-command-object
+type applicationCommandObj struct {
+	ID          snowflake                     `json:"id,omitempty"`      // unique id of the command
+	Type        int                           `json:"type,omitempty"`    // the type of command, defaults to 1 (CHAT_INPUT)
+	Name        string                        `json:"name"`              // 1-32 character name
+	Description string                        `json:"description"`       // 1-100 character description for CHAT_INPUT commands
+	Options     []applicationCommandOptionObj `json:"options,omitempty"` // the parameters for the command, max of 25
+}
+
+// https://discord.com/developers/docs/interactions/application-commands#application-command-object-application-command-option-structure
+type applicationCommandOptionObj struct {
+	Type         int    `json:"type"`                   // type of option
+	Name         string `json:"name"`                   // 1-32 character name
+	Description  string `json:"description"`            // 1-100 character description
+	Required     bool   `json:"required,omitempty"`     // if the parameter is required or optional, default false
+	Autocomplete bool   `json:"autocomplete,omitempty"` // if autocomplete interactions are enabled for this option
+}
+
+// https://discord.com/developers/docs/interactions/application-commands#application-command-object-application-command-option-type
+const (
+	OPTION_TYPE_STRING  = 3
+	OPTION_TYPE_INTEGER = 4
+	OPTION_TYPE_BOOLEAN = 5
+	OPTION_TYPE_USER    = 6
+)
+
+// https://discord.com/developers/docs/interactions/receiving-and-responding#interaction-object
+type interactionObj struct {
+	ID            snowflake           `json:"id"`             // id of the interaction
+	ApplicationID snowflake           `json:"application_id"` // id of the application this interaction is for
+	Type          int                 `json:"type"`           // type of interaction
+	Data          *interactionDataObj `json:"data"`           // interaction data payload
+	GuildID       *snowflake          `json:"guild_id"`       // guild that the interaction was sent from
+	ChannelID     *snowflake          `json:"channel_id"`     // channel that the interaction was sent from
+	Member        *guildMemberObj     `json:"member"`         // guild member data for the invoking user, including permissions
+	User          *userObj            `json:"user"`           // user object for the invoking user, if invoked in a DM
+	Token         string              `json:"token"`          // continuation token for responding to the interaction
+	Version       int                 `json:"version"`        // read-only property, always 1
+	Message       *messageObj         `json:"message"`        // for components, the message they were attached to
+}
+
+// user returns the user who invoked the interaction, in a guild or a DM
+func (i *interactionObj) user() *userObj {
+	if i.Member != nil && i.Member.User != nil {
+		return i.Member.User
+	}
+	return i.User
+}
+
+// https://discord.com/developers/docs/interactions/receiving-and-responding#interaction-object-interaction-type
+const (
+	INTERACTION_TYPE_PING                             = 1
+	INTERACTION_TYPE_APPLICATION_COMMAND              = 2
+	INTERACTION_TYPE_MESSAGE_COMPONENT                = 3
+	INTERACTION_TYPE_APPLICATION_COMMAND_AUTOCOMPLETE = 4
+	INTERACTION_TYPE_MODAL_SUBMIT                     = 5
+)
+
+// https://discord.com/developers/docs/interactions/receiving-and-responding#interaction-object-application-command-data-structure
+// https://discord.com/developers/docs/interactions/receiving-and-responding#interaction-object-message-component-data-structure
+type interactionDataObj struct {
+	ID            snowflake              `json:"id"`             // the ID of the invoked command
+	Name          string                 `json:"name"`           // the name of the invoked command
+	Type          int                    `json:"type"`           // the type of the invoked command
+	Options       []interactionOptionObj `json:"options"`        // the params + values from the user
+	CustomID      string                 `json:"custom_id"`      // the custom_id of the component
+	ComponentType int                    `json:"component_type"` // the type of the component
+	Values        []string               `json:"values"`         // values the user selected in a select menu component
+	Components    []componentObj         `json:"components"`     // the values submitted by the user in a modal
+}
+
+// textInput returns the value of the text input with the given custom_id in
+// a submitted modal
+func (d *interactionDataObj) textInput(customID string) string {
+	for _, row := range d.Components {
+		for _, component := range row.Components {
+			if component.CustomID == customID {
+				return component.Value
+			}
+		}
+	}
+	return ""
+}
+
+// https://discord.com/developers/docs/interactions/receiving-and-responding#interaction-object-application-command-interaction-data-option-structure
+type interactionOptionObj struct {
+	Name    string                 `json:"name"`    // the name of the parameter
+	Type    int                    `json:"type"`    // value of application command option type
+	Value   json.RawMessage        `json:"value"`   // the value of the option resulting from user input
+	Options []interactionOptionObj `json:"options"` // present if this option is a group or subcommand
+	Focused bool                   `json:"focused"` // true if this option is the currently focused option for autocomplete
+}
+
+// option returns the option with the given name, or nil if the user did not
+// give it
+func (d *interactionDataObj) option(name string) *interactionOptionObj {
+	for i := range d.Options {
+		if d.Options[i].Name == name {
+			return &d.Options[i]
+		}
+	}
+	return nil
+}
+
+// focused returns the option the user is typing in, for autocomplete
+func (d *interactionDataObj) focused() *interactionOptionObj {
+	for i := range d.Options {
+		if d.Options[i].Focused {
+			return &d.Options[i]
+		}
+	}
+	return nil
+}
+
+// stringValue returns the value of a string option, partial values of
+// autocomplete interactions included
+func (o *interactionOptionObj) stringValue() string {
+	var s string
+	if err := json.Unmarshal(o.Value, &s); err != nil {
+		return ""
+	}
+	return s
+}
+
+// https://discord.com/developers/docs/interactions/receiving-and-responding#interaction-response-object
+type interactionResponseObj struct {
+	Type int                         `json:"type"`           // the type of response
+	Data *interactionCallbackDataObj `json:"data,omitempty"` // an optional response message
+
+	// after is run once the response has been sent, for deferred responses
+	// with work that takes longer than discord waits for the response
+	after func()
+}
+
+// https://discord.com/developers/docs/interactions/receiving-and-responding#interaction-response-object-interaction-callback-type
+const (
+	INTERACTION_CALLBACK_PONG                                    = 1
+	INTERACTION_CALLBACK_CHANNEL_MESSAGE_WITH_SOURCE             = 4
+	INTERACTION_CALLBACK_DEFERRED_CHANNEL_MESSAGE_WITH_SOURCE    = 5
+	INTERACTION_CALLBACK_DEFERRED_UPDATE_MESSAGE                 = 6
+	INTERACTION_CALLBACK_UPDATE_MESSAGE                          = 7
+	INTERACTION_CALLBACK_APPLICATION_COMMAND_AUTOCOMPLETE_RESULT = 8
+	INTERACTION_CALLBACK_MODAL                                   = 9
+)
+
+// https://discord.com/developers/docs/interactions/receiving-and-responding#interaction-response-object-messages
+type interactionCallbackDataObj struct {
+	Content         string              `json:"content,omitempty"`          // message content
+	Embeds          []embedObj          `json:"embeds,omitempty"`           // supports up to 10 embeds
+	AllowedMentions *allowedMentionsObj `json:"allowed_mentions,omitempty"` // allowed mentions object
+	Flags           int                 `json:"flags,omitempty"`            // message flags combined as a bitfield
+	Components      []componentObj      `json:"components,omitempty"`       // message components
+	Choices         []commandChoiceObj  `json:"choices,omitempty"`          // autocomplete choices (max of 25 choices)
+	CustomID        string              `json:"custom_id,omitempty"`        // a developer-defined identifier for the modal
+	Title           string              `json:"title,omitempty"`            // the title of the modal
+}
+
+// https://discord.com/developers/docs/interactions/application-commands#application-command-object-application-command-option-choice-structure
+type commandChoiceObj struct {
+	Name  string `json:"name"`  // 1-100 character choice name
+	Value string `json:"value"` // value for the choice, up to 100 characters if string
+}
+
+// https://discord.com/developers/docs/resources/channel#message-object-message-flags
+const (
+	MESSAGE_FLAG_EPHEMERAL = 1 << 6
+)
+
+// componentObj is any message component, the fields used depend on the type
+// https://discord.com/developers/docs/interactions/message-components#component-object
+type componentObj struct {
+	Type        int               `json:"type"`                  // component type
+	CustomID    string            `json:"custom_id,omitempty"`   // a developer-defined identifier for the component, max 100 characters
+	Style       int               `json:"style,omitempty"`       // one of button styles
+	Label       string            `json:"label,omitempty"`       // text that appears on the button, max 80 characters
+	URL         string            `json:"url,omitempty"`         // a url for link-style buttons
+	Disabled    bool              `json:"disabled,omitempty"`    // whether the component is disabled, default false
+	Options     []selectOptionObj `json:"options,omitempty"`     // the choices in the select, max 25
+	Placeholder string            `json:"placeholder,omitempty"` // custom placeholder text if nothing is selected, max 150 characters
+	MinValues   *int              `json:"min_values,omitempty"`  // the minimum number of items that must be chosen; default 1, min 0, max 25
+	MaxValues   *int              `json:"max_values,omitempty"`  // the maximum number of items that can be chosen; default 1, max 25
+	Components  []componentObj    `json:"components,omitempty"`  // the components of an action row
+	Value       string            `json:"value,omitempty"`       // pre-filled value of a text input, or the value submitted in a modal
+	Required    *bool             `json:"required,omitempty"`    // whether a text input is required to be filled, default true
+	MinLength   int               `json:"min_length,omitempty"`  // minimum input length for a text input, min 0, max 4000
+	MaxLength   int               `json:"max_length,omitempty"`  // maximum input length for a text input, min 1, max 4000
+}
+
+// https://discord.com/developers/docs/interactions/message-components#component-object-component-types
+const (
+	COMPONENT_TYPE_ACTION_ROW    = 1
+	COMPONENT_TYPE_BUTTON        = 2
+	COMPONENT_TYPE_STRING_SELECT = 3
+	COMPONENT_TYPE_TEXT_INPUT    = 4
+)
+
+// https://discord.com/developers/docs/interactions/message-components#text-input-object-text-input-styles
+const (
+	TEXT_INPUT_STYLE_SHORT     = 1
+	TEXT_INPUT_STYLE_PARAGRAPH = 2
+)
+
+// https://discord.com/developers/docs/interactions/message-components#button-object-button-styles
+const (
+	BUTTON_STYLE_PRIMARY   = 1
+	BUTTON_STYLE_SECONDARY = 2
+	BUTTON_STYLE_SUCCESS   = 3
+	BUTTON_STYLE_DANGER    = 4
+	BUTTON_STYLE_LINK      = 5
+)
+
+// https://discord.com/developers/docs/interactions/message-components#select-menu-object-select-option-structure
+type selectOptionObj struct {
+	Label       string `json:"label"`                 // user-facing name of the option, max 100 characters
+	Value       string `json:"value"`                 // dev-defined value of the option, max 100 characters
+	Description string `json:"description,omitempty"` // additional description of the option, max 100 characters
+	Default     bool   `json:"default,omitempty"`     // will show this option as selected by default
+}
+
+// actionRow puts components in an action row, which is required for
+// components in messages
+func actionRow(components ...componentObj) componentObj {
+	return componentObj{
+		Type:       COMPONENT_TYPE_ACTION_ROW,
+		Components: components,
+	}
 }
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// JSON error codes we treat specially, see
+// https://discord.com/developers/docs/topics/opcodes-and-status-codes#json-json-error-codes
+const (
+	errorCodeUnknownChannel     = 10003
+	errorCodeUnknownWebhook     = 10015
+	errorCodeMissingAccess      = 50001
+	errorCodeMissingPermissions = 50013
+)
+
+// discordAPIError is returned by the restClient for non-2xx responses
+// https://discord.com/developers/docs/reference#error-messages
+type discordAPIError struct {
+	Status  int          // the HTTP status code
+	Code    int          // the discord JSON error code, 0 if the body had none
+	Message string       // the discord error message, or the body if it was not JSON
+	Fields  []fieldError // the errors of individual fields of the request
+}
+
+// fieldError is an error for a single field of a request, the path is the
+// dotted path to the field such as "embeds.0.title"
+type fieldError struct {
+	Path    string
+	Code    string
+	Message string
+}
+
+func (err *discordAPIError) Error() string {
+	msg := fmt.Sprintf("discord API error %d (HTTP %d): %s", err.Code, err.Status, err.Message)
+	for _, field := range err.Fields {
+		msg += fmt.Sprintf("; %s: %s", field.Path, field.Message)
+	}
+	return msg
+}
+
+// newAPIError reads a non-2xx response into a discordAPIError
+func newAPIError(res *http.Response) error {
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("reading error response with status %s: %w", res.Status, err)
+	}
+	return parseAPIError(res.StatusCode, body)
+}
+
+func parseAPIError(status int, body []byte) *discordAPIError {
+	apiErr := &discordAPIError{Status: status}
+	var errResp struct {
+		Code    int             `json:"code"`
+		Message string          `json:"message"`
+		Errors  json.RawMessage `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &errResp); err != nil {
+		apiErr.Message = strings.TrimSpace(string(body))
+		return apiErr
+	}
+	apiErr.Code = errResp.Code
+	apiErr.Message = errResp.Message
+	if len(errResp.Errors) > 0 {
+		apiErr.Fields = flattenFieldErrors("", errResp.Errors)
+	}
+	return apiErr
+}
+
+// flattenFieldErrors walks the nested errors object, where the leaves are
+// "_errors" arrays and the keys on the way are the path to the field
+func flattenFieldErrors(path string, data json.RawMessage) []fieldError {
+	var node map[string]json.RawMessage
+	if err := json.Unmarshal(data, &node); err != nil {
+		return nil
+	}
+	keys := make([]string, 0, len(node))
+	for key := range node {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var fields []fieldError
+	for _, key := range keys {
+		if key == "_errors" {
+			var errs []struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			}
+			if err := json.Unmarshal(node[key], &errs); err != nil {
+				continue
+			}
+			for _, e := range errs {
+				fields = append(fields, fieldError{Path: path, Code: e.Code, Message: e.Message})
+			}
+			continue
+		}
+		child := key
+		if path != "" {
+			child = path + "." + key
+		}
+		fields = append(fields, flattenFieldErrors(child, node[key])...)
+	}
+	return fields
+}
+
+// isPermissionError reports whether err means the bot is not allowed to do
+// what it tried, retrying will not help until someone changes the permissions
+func isPermissionError(err error) bool {
+	var apiErr *discordAPIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.Code {
+	case errorCodeMissingAccess, errorCodeMissingPermissions:
+		return true
+	}
+	return apiErr.Status == http.StatusUnauthorized || apiErr.Status == http.StatusForbidden
+}
+
+// isTransientError reports whether the request might succeed if it is
+// retried later. Errors that are not from discord, such as network errors,
+// are transient.
+func isTransientError(err error) bool {
+	var apiErr *discordAPIError
+	if !errors.As(err, &apiErr) {
+		return err != nil
+	}
+	return apiErr.Status == http.StatusTooManyRequests || apiErr.Status >= 500
+}
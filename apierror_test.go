@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestParseAPIError(t *testing.T) {
+	body := []byte(`{
+		"code": 50035,
+		"message": "Invalid Form Body",
+		"errors": {
+			"content": {"_errors": [{"code": "BASE_TYPE_MAX_LENGTH", "message": "Must be 2000 or fewer in length."}]},
+			"embeds": {"0": {"title": {"_errors": [{"code": "BASE_TYPE_REQUIRED", "message": "This field is required"}]}}}
+		}
+	}`)
+	err := parseAPIError(http.StatusBadRequest, body)
+	want := &discordAPIError{
+		Status:  http.StatusBadRequest,
+		Code:    50035,
+		Message: "Invalid Form Body",
+		Fields: []fieldError{
+			{Path: "content", Code: "BASE_TYPE_MAX_LENGTH", Message: "Must be 2000 or fewer in length."},
+			{Path: "embeds.0.title", Code: "BASE_TYPE_REQUIRED", Message: "This field is required"},
+		},
+	}
+	if !reflect.DeepEqual(err, want) {
+		t.Errorf("parseAPIError() = %+v, want %+v", err, want)
+	}
+	if isPermissionError(err) || isTransientError(err) {
+		t.Errorf("invalid form body should be neither a permission nor a transient error")
+	}
+}
+
+func TestAPIErrorKinds(t *testing.T) {
+	missingAccess := parseAPIError(http.StatusForbidden, []byte(`{"code": 50001, "message": "Missing Access"}`))
+	if !isPermissionError(fmt.Errorf("creating message: %w", missingAccess)) {
+		t.Errorf("Missing Access should be a permission error")
+	}
+	badGateway := parseAPIError(http.StatusBadGateway, []byte("<html>bad gateway</html>"))
+	if !isTransientError(badGateway) || badGateway.Message != "<html>bad gateway</html>" {
+		t.Errorf("502 with a HTML body should be a transient error, got %+v", badGateway)
+	}
+}
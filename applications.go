@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Application statuses
+const (
+	applicationPending  = "pending"
+	applicationApproved = "approved"
+	applicationDenied   = "denied"
+)
+
+// decideTimeout is how long a decision in progress keeps other admins from
+// deciding, in case the deferred response never finishes
+const decideTimeout = time.Minute
+
+var playerNameRegex = regexp.MustCompile(`^[A-Za-z0-9_]{3,16}$`)
+
+// application is a request to be whitelisted on the minecraft server
+type application struct {
+	ID        string    `json:"id"`
+	UserID    snowflake `json:"user_id"`  // the discord user who applied
+	Username  string    `json:"username"` // the name of the user when they applied
+	Player    string    `json:"player"`   // the minecraft name to whitelist
+	Reason    string    `json:"reason"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	DecidedBy snowflake `json:"decided_by,omitempty"` // the admin who approved or denied
+}
+
+// applicationWorkflow lets users apply for the whitelist with /apply, and
+// admins approve or deny the applications in the admin channel
+type applicationWorkflow struct {
+	sync.Mutex
+	path         string // where the applications are saved, empty to only keep them in memory
+	applications map[string]*application
+
+	deciding map[string]time.Time // when an admin started deciding on an application
+
+	restClient   *restClient
+	adminChannel snowflake
+	rcon         *rconClient // nil if whitelisting has to be done by hand
+}
+
+// loadApplicationWorkflow reads the applications from dir, an empty dir
+// keeps the applications in memory only
+func loadApplicationWorkflow(dir string, restClient *restClient, adminChannel snowflake, rcon *rconClient) (*applicationWorkflow, error) {
+	w := &applicationWorkflow{
+		applications: map[string]*application{},
+		deciding:     map[string]time.Time{},
+		restClient:   restClient,
+		adminChannel: adminChannel,
+		rcon:         rcon,
+	}
+	if dir == "" {
+		fmt.Println("No state directory, whitelist applications are lost on restart")
+		return w, nil
+	}
+	w.path = filepath.Join(dir, "applications.json")
+	data, err := os.ReadFile(w.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return w, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("reading applications: %w", err)
+	}
+	if err := json.Unmarshal(data, &w.applications); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", w.path, err)
+	}
+	return w, nil
+}
+
+// save writes the applications to disk, w must be locked
+func (w *applicationWorkflow) save() {
+	if w.path == "" {
+		return
+	}
+	if err := writeFileAtomic(w.path, w.applications); err != nil {
+		fmt.Printf("Failed to save applications: %+v\n", err)
+	}
+}
+
+// register adds /apply, its modal and the approve and deny buttons to h
+func (w *applicationWorkflow) register(h *interactionHandler) {
+	h.addCommand(command{
+		definition: applicationCommandObj{
+			Name:        "apply",
+			Description: "Apply to be whitelisted on the minecraft server",
+		},
+		run: w.apply,
+	})
+	h.modals["apply"] = w.submit
+	h.components["approve"] = func(i *interactionObj, id string) interactionResponseObj {
+		return w.decide(i, id, applicationApproved)
+	}
+	h.components["deny"] = func(i *interactionObj, id string) interactionResponseObj {
+		return w.decide(i, id, applicationDenied)
+	}
+}
+
+// apply opens the application form
+func (w *applicationWorkflow) apply(i *interactionObj) interactionResponseObj {
+	required := true
+	return interactionResponseObj{
+		Type: INTERACTION_CALLBACK_MODAL,
+		Data: &interactionCallbackDataObj{
+			CustomID: "apply",
+			Title:    "Apply for the whitelist",
+			Components: []componentObj{
+				actionRow(componentObj{
+					Type:      COMPONENT_TYPE_TEXT_INPUT,
+					CustomID:  "player",
+					Style:     TEXT_INPUT_STYLE_SHORT,
+					Label:     "Minecraft name",
+					Required:  &required,
+					MinLength: 3,
+					MaxLength: 16,
+				}),
+				actionRow(componentObj{
+					Type:      COMPONENT_TYPE_TEXT_INPUT,
+					CustomID:  "reason",
+					Style:     TEXT_INPUT_STYLE_PARAGRAPH,
+					Label:     "Why do you want to join?",
+					Required:  &required,
+					MaxLength: 500,
+				}),
+			},
+		},
+	}
+}
+
+// submit posts a submitted application form to the admin channel, the
+// response is deferred as posting it can take longer than discord waits
+func (w *applicationWorkflow) submit(i *interactionObj) interactionResponseObj {
+	user := i.user()
+	if user == nil {
+		return ephemeralResponse("Sorry, I don't know who you are")
+	}
+	player := strings.TrimSpace(i.Data.textInput("player"))
+	if !playerNameRegex.MatchString(player) {
+		return ephemeralResponse(fmt.Sprintf("%s is not a valid minecraft name", escapeMarkdown(player)))
+	}
+	id, err := newNonce()
+	if err != nil {
+		fmt.Printf("Failed to create application id: %+v\n", err)
+		return ephemeralResponse("Sorry, something went wrong")
+	}
+	app := &application{
+		ID:        id,
+		UserID:    user.ID,
+		Username:  user.Username,
+		Player:    player,
+		Reason:    strings.TrimSpace(i.Data.textInput("reason")),
+		Status:    applicationPending,
+		CreatedAt: time.Now(),
+	}
+
+	return deferredResponse(i, true, func() {
+		// Store the application first, so that it is known as soon as the
+		// buttons of the card can be pressed
+		w.Lock()
+		w.applications[app.ID] = app
+		w.save()
+		w.Unlock()
+		if _, err := w.restClient.createMessage(w.adminChannel, applicationCard(app)); err != nil {
+			fmt.Printf("Failed to post application to DISCRAFT_ADMIN_CHANNEL: %+v\n", err)
+			w.Lock()
+			delete(w.applications, app.ID)
+			w.save()
+			w.Unlock()
+			editResponse(w.restClient, i, messageCreateParams{Content: "Sorry, I could not send your application to the admins"})
+			return
+		}
+		fmt.Printf("%s applied to whitelist %s\n", app.Username, app.Player)
+		editResponse(w.restClient, i, messageCreateParams{Content: fmt.Sprintf("Your application for %s was sent to the admins", escapeMarkdown(player))})
+	})
+}
+
+// decide approves or denies an application when an admin presses a button.
+// The card is updated once the player has been whitelisted, as RCON can take
+// longer than discord waits for the response.
+func (w *applicationWorkflow) decide(i *interactionObj, id string, status string) interactionResponseObj {
+	admin := i.user()
+	if admin == nil || i.Member == nil || i.Member.Permissions == nil ||
+		*i.Member.Permissions&(PERMISSION_ADMINISTRATOR|PERMISSION_MANAGE_GUILD) == 0 {
+		return ephemeralResponse("Only admins can decide on applications")
+	}
+
+	w.Lock()
+	defer w.Unlock()
+	app, ok := w.applications[id]
+	if !ok {
+		return ephemeralResponse("I don't know about this application anymore")
+	}
+	if app.Status != applicationPending {
+		return updateResponse(applicationCard(app))
+	}
+	if started, ok := w.deciding[id]; ok && time.Since(started) < decideTimeout {
+		return ephemeralResponse("Another admin is deciding on this application right now")
+	}
+	w.deciding[id] = time.Now()
+	player := app.Player
+
+	return deferredResponse(i, false, func() {
+		note, err := w.whitelist(player, status)
+
+		w.Lock()
+		delete(w.deciding, id)
+		if err == nil {
+			app.Status = status
+			app.DecidedBy = admin.ID
+			w.save()
+			go w.notify(*app)
+		}
+		card := applicationCard(app)
+		w.Unlock()
+
+		if note != "" {
+			card.Content = escapeMarkdown(note)
+		}
+		editResponse(w.restClient, i, card)
+	})
+}
+
+// whitelist adds an approved player to the whitelist, and returns a note for
+// the admins if they have to do something. The application stays pending if
+// an error is returned.
+func (w *applicationWorkflow) whitelist(player string, status string) (string, error) {
+	if status != applicationApproved {
+		return "", nil
+	}
+	if w.rcon == nil {
+		return fmt.Sprintf("Whitelist %s by hand, RCON is not configured", player), nil
+	}
+	res, err := w.rcon.run("whitelist add " + player)
+	if err != nil {
+		fmt.Printf("Failed to whitelist %s: %+v\n", player, err)
+		return fmt.Sprintf("Failed to whitelist %s: %s", player, err), err
+	}
+	fmt.Printf("RCON whitelist add %s: %s\n", player, res)
+	return "", nil
+}
+
+// notify tells the applicant about the decision in a DM
+func (w *applicationWorkflow) notify(app application) {
+	dm, err := w.restClient.createDM(app.UserID)
+	if err != nil {
+		fmt.Printf("Failed to open DM with %s: %+v\n", app.Username, err)
+		return
+	}
+	content := fmt.Sprintf("Your application to whitelist %s was denied", escapeMarkdown(app.Player))
+	if app.Status == applicationApproved {
+		content = fmt.Sprintf("Your application was approved, %s is now whitelisted!", escapeMarkdown(app.Player))
+	}
+	if _, err := w.restClient.createMessage(dm.ID, messageCreateParams{Content: content, AllowedMentions: noMentions()}); err != nil {
+		// Users can have DMs from server members turned off
+		fmt.Printf("Failed to DM %s: %+v\n", app.Username, err)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestApplicationsSurviveRestart(t *testing.T) {
+	dir := t.TempDir()
+	w, err := loadApplicationWorkflow(dir, nil, "1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Lock()
+	w.applications["a"] = &application{
+		ID:        "a",
+		UserID:    "3",
+		Username:  "someone",
+		Player:    "Steve",
+		Reason:    "to build",
+		Status:    applicationApproved,
+		CreatedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		DecidedBy: "9",
+	}
+	w.save()
+	w.Unlock()
+
+	loaded, err := loadApplicationWorkflow(dir, nil, "1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.applications, w.applications) {
+		t.Errorf("loaded %+v, want %+v", loaded.applications["a"], w.applications["a"])
+	}
+}
+
+func TestDecideKeepsFailedApprovalPending(t *testing.T) {
+	var mu sync.Mutex
+	var edits []webhookEditMessageParams
+	rc := fakeRESTClient(func(req *http.Request) *http.Response {
+		if req.Method == "PATCH" {
+			var edit webhookEditMessageParams
+			if err := json.NewDecoder(req.Body).Decode(&edit); err != nil {
+				t.Errorf("decoding edit: %+v", err)
+			}
+			mu.Lock()
+			edits = append(edits, edit)
+			mu.Unlock()
+		}
+		return fakeResponse(200, nil, "{}")
+	})
+	// The server refuses the password, so whitelisting fails
+	rcon := &rconClient{addr: fakeRCONServer(t, "secret"), password: "wrong"}
+	w, err := loadApplicationWorkflow(t.TempDir(), rc, "1", rcon)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.applications["a"] = &application{ID: "a", UserID: "3", Player: "Steve", Status: applicationPending}
+
+	perms := permissionSet(PERMISSION_MANAGE_GUILD)
+	i := &interactionObj{
+		ApplicationID: "5",
+		Token:         "tok",
+		Type:          INTERACTION_TYPE_MESSAGE_COMPONENT,
+		Member:        &guildMemberObj{User: &userObj{ID: "9"}, Permissions: &perms},
+		Data:          &interactionDataObj{CustomID: "approve:a"},
+	}
+	response := w.decide(i, "a", applicationApproved)
+	if response.Type != INTERACTION_CALLBACK_DEFERRED_UPDATE_MESSAGE || response.after == nil {
+		t.Fatalf("decide() = %+v, want a deferred update", response)
+	}
+	response.after()
+
+	if status := w.applications["a"].Status; status != applicationPending {
+		t.Errorf("status = %s after a failed whitelist, want %s", status, applicationPending)
+	}
+	if _, ok := w.deciding["a"]; ok {
+		t.Error("the application is still being decided on")
+	}
+	if len(edits) != 1 {
+		t.Fatalf("edited the card %d times, want once", len(edits))
+	}
+	if !strings.Contains(edits[0].Content, "Failed to whitelist Steve") {
+		t.Errorf("card content is %q, want the whitelist error", edits[0].Content)
+	}
+	if buttons := edits[0].Components[0].Components; buttons[0].Disabled || buttons[1].Disabled {
+		t.Error("the buttons of a pending application are disabled")
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"math/rand"
+	"time"
+)
+
+// backoff calculates capped exponential backoff with jitter, see
+// https://aws.amazon.com/blogs/architecture/exponential-backoff-and-jitter/
+type backoff struct {
+	min     time.Duration
+	max     time.Duration
+	attempt int
+}
+
+// next returns how long to wait before the next attempt
+func (b *backoff) next() time.Duration {
+	d := b.min << b.attempt
+	if d > b.max || d <= 0 {
+		d = b.max
+	} else {
+		b.attempt++
+	}
+	// Wait at least half of the backoff so that retries never stampede
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func (b *backoff) reset() {
+	b.attempt = 0
+}
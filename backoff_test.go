@@ -0,0 +1,23 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	b := backoff{min: time.Second, max: 10 * time.Second}
+	// The full backoff of each attempt, jitter picks something in [d/2, d]
+	for i, want := range []time.Duration{
+		time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second,
+	} {
+		if d := b.next(); d < want/2 || d > want {
+			t.Errorf("attempt %d: next() = %v, want between %v and %v", i, d, want/2, want)
+		}
+	}
+
+	b.reset()
+	if d := b.next(); d < time.Second/2 || d > time.Second {
+		t.Errorf("after reset: next() = %v, want between %v and %v", d, time.Second/2, time.Second)
+	}
+}
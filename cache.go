@@ -0,0 +1,236 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// guildCache keeps the state of the guilds the bot is in, kept up to date from
+// the guild, channel, role and member dispatches
+type guildCache struct {
+	sync.RWMutex
+	guilds   map[snowflake]*cachedGuild
+	channels map[snowflake]snowflake // channel id to guild id
+}
+
+type cachedGuild struct {
+	guild    guildObj
+	roles    map[snowflake]roleObj
+	channels map[snowflake]channelObj
+	members  map[snowflake]guildMemberObj
+}
+
+func newGuildCache() *guildCache {
+	return &guildCache{
+		guilds:   map[snowflake]*cachedGuild{},
+		channels: map[snowflake]snowflake{},
+	}
+}
+
+// subscribe keeps the cache up to date with the dispatches of d. Members
+// other than discraft itself are only tracked if members is set, as the
+// member events need the privileged guild members intent.
+func (c *guildCache) subscribe(d *dispatcher, members bool) {
+	onDispatch(d, "GUILD_CREATE", c.guildCreate)
+	onDispatch(d, "GUILD_UPDATE", func(e *dispatchGuildUpdate) {
+		c.Lock()
+		defer c.Unlock()
+		if g, ok := c.guilds[e.ID]; ok {
+			g.setGuild(guildObj(*e))
+		}
+	})
+	onDispatch(d, "GUILD_DELETE", func(e *dispatchGuildDelete) {
+		c.Lock()
+		defer c.Unlock()
+		if g, ok := c.guilds[e.ID]; ok {
+			for id := range g.channels {
+				delete(c.channels, id)
+			}
+		}
+		delete(c.guilds, e.ID)
+	})
+	onDispatch(d, "CHANNEL_CREATE", func(e *dispatchChannelCreate) {
+		c.setChannel(channelObj(*e))
+	})
+	onDispatch(d, "CHANNEL_UPDATE", func(e *dispatchChannelUpdate) {
+		c.setChannel(channelObj(*e))
+	})
+	onDispatch(d, "CHANNEL_DELETE", func(e *dispatchChannelDelete) {
+		c.Lock()
+		defer c.Unlock()
+		if g, ok := c.guilds[c.channels[e.ID]]; ok {
+			delete(g.channels, e.ID)
+		}
+		delete(c.channels, e.ID)
+	})
+	if members {
+		onDispatch(d, "GUILD_MEMBER_ADD", func(e *dispatchGuildMemberAdd) {
+			c.setMember(e.GuildID, e.guildMemberObj)
+		})
+		onDispatch(d, "GUILD_MEMBER_UPDATE", func(e *dispatchGuildMemberUpdate) {
+			c.setMember(e.GuildID, e.guildMemberObj)
+		})
+		onDispatch(d, "GUILD_MEMBER_REMOVE", func(e *dispatchGuildMemberRemove) {
+			c.Lock()
+			defer c.Unlock()
+			if g, ok := c.guilds[e.GuildID]; ok {
+				delete(g.members, e.User.ID)
+			}
+		})
+	}
+	onDispatch(d, "GUILD_ROLE_CREATE", func(e *dispatchGuildRoleCreate) {
+		c.setRole(e.GuildID, e.Role)
+	})
+	onDispatch(d, "GUILD_ROLE_UPDATE", func(e *dispatchGuildRoleUpdate) {
+		c.setRole(e.GuildID, e.Role)
+	})
+	onDispatch(d, "GUILD_ROLE_DELETE", func(e *dispatchGuildRoleDelete) {
+		c.Lock()
+		defer c.Unlock()
+		if g, ok := c.guilds[e.GuildID]; ok {
+			delete(g.roles, e.RoleID)
+		}
+	})
+}
+
+func (c *guildCache) guildCreate(e *dispatchGuildCreate) {
+	c.Lock()
+	defer c.Unlock()
+	g := &cachedGuild{
+		channels: map[snowflake]channelObj{},
+		members:  map[snowflake]guildMemberObj{},
+	}
+	g.setGuild(e.guildObj)
+	for _, channel := range e.Channels {
+		guildID := e.ID // not set on the channels of GUILD_CREATE
+		channel.GuildID = &guildID
+		g.channels[channel.ID] = channel
+		c.channels[channel.ID] = e.ID
+	}
+	for _, member := range e.Members {
+		if member.User != nil {
+			g.members[member.User.ID] = member
+		}
+	}
+	c.guilds[e.ID] = g
+}
+
+func (g *cachedGuild) setGuild(guild guildObj) {
+	g.guild = guild
+	g.roles = map[snowflake]roleObj{}
+	for _, role := range guild.Roles {
+		g.roles[role.ID] = role
+	}
+}
+
+func (c *guildCache) setChannel(channel channelObj) {
+	if channel.GuildID == nil {
+		return // DMs are not cached
+	}
+	c.Lock()
+	defer c.Unlock()
+	if g, ok := c.guilds[*channel.GuildID]; ok {
+		g.channels[channel.ID] = channel
+		c.channels[channel.ID] = *channel.GuildID
+	}
+}
+
+func (c *guildCache) setMember(guildID snowflake, member guildMemberObj) {
+	if member.User == nil {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	if g, ok := c.guilds[guildID]; ok {
+		g.members[member.User.ID] = member
+	}
+}
+
+func (c *guildCache) setRole(guildID snowflake, role roleObj) {
+	c.Lock()
+	defer c.Unlock()
+	if g, ok := c.guilds[guildID]; ok {
+		g.roles[role.ID] = role
+	}
+}
+
+func (c *guildCache) hasGuild(guildID snowflake) bool {
+	c.RLock()
+	defer c.RUnlock()
+	_, ok := c.guilds[guildID]
+	return ok
+}
+
+func (c *guildCache) channel(channelID snowflake) (channelObj, bool) {
+	c.RLock()
+	defer c.RUnlock()
+	g, ok := c.guilds[c.channels[channelID]]
+	if !ok {
+		return channelObj{}, false
+	}
+	channel, ok := g.channels[channelID]
+	return channel, ok
+}
+
+// permissions computes the permissions of a user in a channel, see
+// https://discord.com/developers/docs/topics/permissions#permission-overwrites
+func (c *guildCache) permissions(channelID snowflake, userID snowflake) (permissionSet, error) {
+	c.RLock()
+	defer c.RUnlock()
+	g, ok := c.guilds[c.channels[channelID]]
+	if !ok {
+		return 0, fmt.Errorf("channel %s is not in any known guild", channelID)
+	}
+	channel := g.channels[channelID]
+	member, ok := g.members[userID]
+	if !ok {
+		return 0, fmt.Errorf("user %s is not a known member of guild %s", userID, g.guild.ID)
+	}
+
+	if g.guild.OwnerID == userID {
+		return PERMISSION_ALL, nil
+	}
+	perms := g.roles[g.guild.ID].Permissions // @everyone has the same id as the guild
+	for _, roleID := range member.Roles {
+		perms |= g.roles[roleID].Permissions
+	}
+	if perms&PERMISSION_ADMINISTRATOR != 0 {
+		return PERMISSION_ALL, nil
+	}
+
+	overwrites := map[snowflake]overwriteObj{}
+	for _, overwrite := range channel.PermissionOverwrites {
+		overwrites[overwrite.ID] = overwrite
+	}
+	if everyone, ok := overwrites[g.guild.ID]; ok {
+		perms &^= everyone.Deny
+		perms |= everyone.Allow
+	}
+	var allow, deny permissionSet
+	for _, roleID := range member.Roles {
+		if overwrite, ok := overwrites[roleID]; ok {
+			allow |= overwrite.Allow
+			deny |= overwrite.Deny
+		}
+	}
+	perms &^= deny
+	perms |= allow
+	if overwrite, ok := overwrites[userID]; ok {
+		perms &^= overwrite.Deny
+		perms |= overwrite.Allow
+	}
+	return perms, nil
+}
+
+// checkChannel verifies that the user can read and write in the channel
+func (c *guildCache) checkChannel(channelID snowflake, userID snowflake) error {
+	perms, err := c.permissions(channelID, userID)
+	if err != nil {
+		return err
+	}
+	required := permissionSet(PERMISSION_VIEW_CHANNEL | PERMISSION_SEND_MESSAGES)
+	if perms&required != required {
+		return fmt.Errorf("missing View Channel or Send Messages permission in channel %s", channelID)
+	}
+	return nil
+}
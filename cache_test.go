@@ -0,0 +1,71 @@
+package main
+
+import "testing"
+
+func TestPermissions(t *testing.T) {
+	const (
+		view = permissionSet(PERMISSION_VIEW_CHANNEL)
+		send = permissionSet(PERMISSION_SEND_MESSAGES)
+	)
+	user := func(id snowflake) *userObj {
+		return &userObj{ID: id}
+	}
+	c := newGuildCache()
+	c.guildCreate(&dispatchGuildCreate{
+		guildObj: guildObj{
+			ID:      "1",
+			OwnerID: "10",
+			Roles: []roleObj{
+				{ID: "1", Permissions: view | send}, // @everyone
+				{ID: "2", Permissions: PERMISSION_ADMINISTRATOR},
+				{ID: "3"},
+			},
+		},
+		Members: []guildMemberObj{
+			{User: user("10")},
+			{User: user("11"), Roles: []snowflake{"2"}},
+			{User: user("12")},
+			{User: user("13"), Roles: []snowflake{"3"}},
+			{User: user("14"), Roles: []snowflake{"3"}},
+		},
+		Channels: []channelObj{
+			{ID: "100"},
+			{ID: "101", PermissionOverwrites: []overwriteObj{
+				{ID: "1", Type: 0, Deny: view | send},
+				{ID: "3", Type: 0, Allow: view | send},
+				{ID: "14", Type: 1, Deny: send},
+			}},
+		},
+	})
+
+	tests := []struct {
+		name    string
+		channel snowflake
+		user    snowflake
+		perms   permissionSet
+	}{
+		{"owner", "101", "10", PERMISSION_ALL},
+		{"admin", "101", "11", PERMISSION_ALL},
+		{"everyone", "100", "12", view | send},
+		{"everyone deny", "101", "12", 0},
+		{"role allow", "101", "13", view | send},
+		{"member deny", "101", "14", view},
+	}
+	for _, test := range tests {
+		perms, err := c.permissions(test.channel, test.user)
+		if err != nil {
+			t.Errorf("%s: permissions(%s, %s) failed: %+v", test.name, test.channel, test.user, err)
+			continue
+		}
+		if perms != test.perms {
+			t.Errorf("%s: permissions(%s, %s) = %b, want %b", test.name, test.channel, test.user, perms, test.perms)
+		}
+	}
+
+	if _, err := c.permissions("200", "12"); err == nil {
+		t.Error("permissions in an unknown channel succeeded")
+	}
+	if _, err := c.permissions("100", "20"); err == nil {
+		t.Error("permissions of an unknown member succeeded")
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Embed colors of the different kinds of messages
+const (
+	colorJoin  = 0x2ecc71 // green
+	colorPart  = 0x95a5a6 // grey
+	colorAlert = 0xe74c3c // red
+	colorInfo  = 0x3498db // blue
+)
+
+func joinCard(player string) messageCreateParams {
+	return messageCreateParams{
+		Embeds: []embedObj{{
+			Author:    &embedAuthorObj{Name: stripFormatting(player)},
+			Title:     "Joined the game",
+			Color:     colorJoin,
+			Timestamp: time.Now().Format(time.RFC3339),
+		}},
+	}
+}
+
+func partCard(player string) messageCreateParams {
+	return messageCreateParams{
+		Embeds: []embedObj{{
+			Author:    &embedAuthorObj{Name: stripFormatting(player)},
+			Title:     "Left the game",
+			Color:     colorPart,
+			Timestamp: time.Now().Format(time.RFC3339),
+		}},
+	}
+}
+
+func corruptionCard() messageCreateParams {
+	return messageCreateParams{
+		Embeds: []embedObj{{
+			Title:       "Corruption detected",
+			Description: "Corruption detected in log. Someone probably needs to restore a backup!",
+			Color:       colorAlert,
+			Timestamp:   time.Now().Format(time.RFC3339),
+		}},
+	}
+}
+
+// playingCard is the reply to "playing?", players should be sorted
+func playingCard(players []string, maxPlayers int) messageCreateParams {
+	embed := embedObj{
+		Title:  "No one is playing :(",
+		Color:  colorInfo,
+		Footer: &embedFooterObj{Text: fmt.Sprintf("%d/%d players", len(players), maxPlayers)},
+	}
+	if len(players) == 1 {
+		embed.Title = fmt.Sprintf("Currently %s is playing alone", escapeMarkdown(stripFormatting(players[0])))
+	} else if len(players) > 1 {
+		names := make([]string, len(players))
+		for i, player := range players {
+			names[i] = escapeMarkdown(stripFormatting(player))
+		}
+		embed.Title = fmt.Sprintf("Currently %d players are playing", len(players))
+		embed.Fields = []embedFieldObj{{
+			Name:  "Players",
+			Value: strings.Join(names, "\n"),
+		}}
+	}
+	return messageCreateParams{
+		Embeds: []embedObj{embed},
+	}
+}
+
+// statusCard describes the minecraft server
+func statusCard(data presenceData) messageCreateParams {
+	embed := embedObj{
+		Title: "The server is offline",
+		Color: colorAlert,
+	}
+	if data.Online {
+		embed.Title = "The server is online"
+		embed.Color = colorJoin
+		embed.Description = escapeMarkdown(data.MOTD)
+		embed.Fields = []embedFieldObj{
+			{Name: "Players", Value: fmt.Sprintf("%d/%d", data.Count, data.Max), Inline: true},
+			{Name: "Uptime", Value: data.Uptime, Inline: true},
+		}
+	}
+	return messageCreateParams{
+		Embeds: []embedObj{embed},
+	}
+}
+
+// cardViews are the cards that can be refreshed and switched between
+var cardViews = []selectOptionObj{
+	{Label: "Status", Value: "status", Description: "Whether the server is up"},
+	{Label: "Players", Value: "playing", Description: "Who is playing"},
+}
+
+// withControls adds a refresh button and a view select to the card of view
+func withControls(msg messageCreateParams, view string) messageCreateParams {
+	options := make([]selectOptionObj, len(cardViews))
+	copy(options, cardViews)
+	for i := range options {
+		options[i].Default = options[i].Value == view
+	}
+	msg.Components = []componentObj{
+		actionRow(componentObj{
+			Type:     COMPONENT_TYPE_STRING_SELECT,
+			CustomID: "view",
+			Options:  options,
+		}),
+		actionRow(componentObj{
+			Type:     COMPONENT_TYPE_BUTTON,
+			Style:    BUTTON_STYLE_SECONDARY,
+			Label:    "Refresh",
+			CustomID: "refresh:" + view,
+		}),
+	}
+	return msg
+}
+
+// applicationCard shows a whitelist application in the admin channel, with
+// buttons to decide on it
+func applicationCard(app *application) messageCreateParams {
+	embed := embedObj{
+		Title:       fmt.Sprintf("%s wants to join", escapeMarkdown(app.Player)),
+		Description: escapeMarkdown(app.Reason),
+		Color:       colorInfo,
+		Author:      &embedAuthorObj{Name: app.Username},
+		Timestamp:   app.CreatedAt.Format(time.RFC3339),
+		Fields: []embedFieldObj{
+			{Name: "Discord user", Value: fmt.Sprintf("<@%s>", app.UserID), Inline: true},
+		},
+	}
+	msg := messageCreateParams{
+		Embeds:          []embedObj{embed},
+		AllowedMentions: noMentions(),
+	}
+	// Decided applications keep their buttons disabled, as an update without
+	// components would leave the old buttons in place
+	decided := app.Status != applicationPending
+	msg.Components = []componentObj{actionRow(
+		componentObj{Type: COMPONENT_TYPE_BUTTON, Style: BUTTON_STYLE_SUCCESS, Label: "Approve", CustomID: "approve:" + app.ID, Disabled: decided},
+		componentObj{Type: COMPONENT_TYPE_BUTTON, Style: BUTTON_STYLE_DANGER, Label: "Deny", CustomID: "deny:" + app.ID, Disabled: decided},
+	)}
+	switch app.Status {
+	case applicationApproved:
+		msg.Embeds[0].Color = colorJoin
+		msg.Embeds[0].Fields = append(msg.Embeds[0].Fields, embedFieldObj{Name: "Approved by", Value: fmt.Sprintf("<@%s>", app.DecidedBy), Inline: true})
+	case applicationDenied:
+		msg.Embeds[0].Color = colorAlert
+		msg.Embeds[0].Fields = append(msg.Embeds[0].Fields, embedFieldObj{Name: "Denied by", Value: fmt.Sprintf("<@%s>", app.DecidedBy), Inline: true})
+	}
+	return msg
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// dispatchEvents maps the names of dispatch events to the types they are
+// decoded into, see
+// https://discord.com/developers/docs/topics/gateway#commands-and-events-gateway-events
+var dispatchEvents = map[string]func() any{
+	"READY":               newDispatch[dispatchReady],
+	"RESUMED":             newDispatch[dispatchResumed],
+	"MESSAGE_CREATE":      newDispatch[dispatchMessageCreate],
+	"CHANNEL_CREATE":      newDispatch[dispatchChannelCreate],
+	"CHANNEL_UPDATE":      newDispatch[dispatchChannelUpdate],
+	"CHANNEL_DELETE":      newDispatch[dispatchChannelDelete],
+	"GUILD_CREATE":        newDispatch[dispatchGuildCreate],
+	"GUILD_UPDATE":        newDispatch[dispatchGuildUpdate],
+	"GUILD_DELETE":        newDispatch[dispatchGuildDelete],
+	"GUILD_MEMBER_ADD":    newDispatch[dispatchGuildMemberAdd],
+	"GUILD_MEMBER_UPDATE": newDispatch[dispatchGuildMemberUpdate],
+	"GUILD_MEMBER_REMOVE": newDispatch[dispatchGuildMemberRemove],
+	"GUILD_ROLE_CREATE":   newDispatch[dispatchGuildRoleCreate],
+	"GUILD_ROLE_UPDATE":   newDispatch[dispatchGuildRoleUpdate],
+	"GUILD_ROLE_DELETE":   newDispatch[dispatchGuildRoleDelete],
+	"INTERACTION_CREATE":  newDispatch[dispatchInteractionCreate],
+}
+
+func newDispatch[T any]() any {
+	return new(T)
+}
+
+// dispatchUnknown keeps the raw data of dispatch events without a type in
+// dispatchEvents
+type dispatchUnknown struct {
+	Name string
+	Data json.RawMessage
+}
+
+// dispatcher passes dispatch events to the handlers subscribed to them
+type dispatcher struct {
+	sync.RWMutex // protect the handlers
+	handlers     map[string][]func(any)
+}
+
+func newDispatcher() *dispatcher {
+	return &dispatcher{
+		handlers: map[string][]func(any){},
+	}
+}
+
+// onDispatch subscribes handler to the dispatch event with the given name. T
+// is the type registered for the event in dispatchEvents, or dispatchUnknown
+// for events without a registered type.
+func onDispatch[T any](d *dispatcher, name string, handler func(*T)) {
+	d.Lock()
+	defer d.Unlock()
+	d.handlers[name] = append(d.handlers[name], func(data any) {
+		event, ok := data.(*T)
+		if !ok {
+			fmt.Printf("Handler for %s expected %T but got %T\n", name, event, data)
+			return
+		}
+		handler(event)
+	})
+}
+
+func (d *dispatcher) dispatch(payload *wsPayload) {
+	d.RLock()
+	handlers := d.handlers[payload.T]
+	d.RUnlock()
+
+	if len(handlers) == 0 {
+		fmt.Printf("Recieve Dispatch: %s (unhandled)\n", payload.T)
+		return
+	}
+	for _, handler := range handlers {
+		handler(payload.D)
+	}
+}
@@ -1,47 +1,648 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
 )
 
+type gatewayState int
+
+const (
+	gatewayDisconnected gatewayState = iota
+	gatewayConnecting
+	gatewayConnected // a session has been identified or resumed
+)
+
+func (s gatewayState) String() string {
+	switch s {
+	case gatewayDisconnected:
+		return "disconnected"
+	case gatewayConnecting:
+		return "connecting"
+	case gatewayConnected:
+		return "connected"
+	}
+	return fmt.Sprintf("gatewayState(%d)", int(s))
+}
+
+var errNotConnected = errors.New("not connected to the gateway")
+var errGatewayClosed = errors.New("gateway closed")
+
+// Discord allows 120 gateway commands per 60 seconds on every connection, see
+// https://discord.com/developers/docs/topics/gateway#rate-limiting
+const (
+	gatewaySendLimit  = 120
+	gatewaySendWindow = 60 * time.Second
+	// heartbeats count towards the limit but are never delayed, so leave some
+	// room for them
+	gatewayHeartbeatReserve = 5
+)
+
+// errReconnect is returned from serve when Discord asks us to reconnect
+var errReconnect = errors.New("reconnect requested")
+
+// errUnrecoverable is returned from run when reconnecting can not help, such
+// as when the token is invalid
+var errUnrecoverable = errors.New("unrecoverable gateway error")
+
 type gateway struct {
-	wsc *websocket.Conn
+	sync.Mutex // protect the connection and the session state
+	wsc        *websocket.Conn
+
+	restClient *restClient
+	token      string
+	intents    int
+	compress   bool        // whether to use zlib-stream transport compression
+	inflater   *zlibStream // the zlib context of the current connection
+
+	state       gatewayState
+	subscribers []chan gatewayState
+	backoff     backoff
+	identifies  *identifyLimiter         // shared by all shards
+	presence    func() *opUpdatePresence // the initial presence to identify with
+
+	shardID    int
+	shardCount int
+
+	// Session state needed to resume, see
+	// https://discord.com/developers/docs/topics/gateway#resuming
+	sessionID string
+	resumeURL string
+	seq       *int
+
+	stopHeartbeat context.CancelFunc
+	acked         bool // whether the last heartbeat has been acknowledged
+
+	// All writes go through the writer goroutine as the websocket does not
+	// support concurrent writers
+	outbox     chan outbound
+	heartbeats chan outbound // heartbeats skip the outbox queue
+	limiter    sendLimiter
+	done       chan struct{}
 }
 
-func newGateway(gatewayURL string) (*gateway, error) {
-	wsc, _, err := websocket.DefaultDialer.Dial(gatewayURL+"?v=9", nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to dial websocket: %w", err)
+type outbound struct {
+	payload wsPayload
+	result  chan error
+}
+
+// sendLimiter keeps track of the sends within a sliding window
+type sendLimiter struct {
+	limit  int
+	window time.Duration
+	sent   []time.Time
+}
+
+func (l *sendLimiter) prune(now time.Time) {
+	for len(l.sent) > 0 && now.Sub(l.sent[0]) >= l.window {
+		l.sent = l.sent[1:]
+	}
+}
+
+// delay returns how long to wait before sending a regular command
+func (l *sendLimiter) delay(now time.Time) time.Duration {
+	l.prune(now)
+	if len(l.sent) < l.limit-gatewayHeartbeatReserve {
+		return 0
 	}
+	return l.sent[len(l.sent)-(l.limit-gatewayHeartbeatReserve)].Add(l.window).Sub(now)
+}
+
+func (l *sendLimiter) record(now time.Time) {
+	l.prune(now)
+	l.sent = append(l.sent, now)
+}
+
+func (l *sendLimiter) reset() {
+	l.sent = nil
+}
+
+func newGateway(restClient *restClient, token string, intents int, compress bool) *gateway {
 	return &gateway{
-		wsc: wsc,
-	}, nil
+		restClient: restClient,
+		token:      token,
+		intents:    intents,
+		compress:   compress,
+		identifies: newIdentifyLimiter(),
+		shardCount: 1,
+		backoff: backoff{
+			min: time.Second,
+			max: 2 * time.Minute,
+		},
+		outbox:     make(chan outbound),
+		heartbeats: make(chan outbound),
+		limiter: sendLimiter{
+			limit:  gatewaySendLimit,
+			window: gatewaySendWindow,
+		},
+		done: make(chan struct{}),
+	}
+}
+
+// run keeps a connection to the gateway until ctx is cancelled, redialing
+// with backoff whenever the connection is lost. Dispatches are passed to
+// handle, all other opcodes are handled by the gateway itself. An error
+// wrapping errUnrecoverable is returned if reconnecting can not help.
+func (gw *gateway) run(ctx context.Context, handle func(*wsPayload)) error {
+	go func() {
+		<-ctx.Done()
+		close(gw.done)
+		// Only interrupt the reader, the loop below cleans up the connection
+		if wsc := gw.conn(); wsc != nil {
+			wsc.Close()
+		}
+	}()
+	go gw.writer()
+
+	for ctx.Err() == nil {
+		err := gw.connect()
+		if err == nil {
+			err = gw.serve(handle)
+		}
+		gw.disconnect()
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		var closeErr *websocket.CloseError
+		if errors.As(err, &closeErr) {
+			if err := gw.handleClose(closeErr); err != nil {
+				return err
+			}
+		}
+		var apiErr *discordAPIError
+		if errors.As(err, &apiErr) && apiErr.Status == http.StatusUnauthorized {
+			return fmt.Errorf("%w: Discord rejected DISCRAFT_TOKEN: %v", errUnrecoverable, err)
+		}
+
+		gw.Lock()
+		wait := gw.backoff.next()
+		gw.Unlock()
+		fmt.Printf("Gateway connection lost, reconnecting in %v: %+v\n", wait, err)
+		select {
+		case <-ctx.Done():
+		case <-time.After(wait):
+		}
+	}
+	return nil
+}
+
+// handleClose deals with the close codes that need more than a reconnect, see
+// https://discord.com/developers/docs/topics/opcodes-and-status-codes#gateway-gateway-close-event-codes
+func (gw *gateway) handleClose(closeErr *websocket.CloseError) error {
+	switch closeErr.Code {
+	case 4014: // Disallowed intent(s)
+		return fmt.Errorf("%w: %s", errUnrecoverable, explainDisallowedIntents(gw.intents))
+	case 4004, 4010, 4011, 4012, 4013:
+		return fmt.Errorf("%w: gateway closed the connection with code %d: %s", errUnrecoverable, closeErr.Code, closeErr.Text)
+	case 4007, 4009: // Invalid seq and Session timed out
+		gw.invalidateSession()
+	}
+	return nil
+}
+
+// connect dials the resume URL if we have a session to resume, otherwise a
+// freshly fetched gateway URL.
+func (gw *gateway) connect() error {
+	gw.setState(gatewayConnecting)
+
+	gw.Lock()
+	url := gw.resumeURL
+	if gw.sessionID == "" {
+		url = ""
+	}
+	gw.Unlock()
+
+	if url == "" {
+		bot, err := gw.restClient.getGatewayBot()
+		if err != nil {
+			return fmt.Errorf("getting gateway URL: %w", err)
+		}
+		gw.identifies.update(bot.SessionStartLimit)
+		// Wait for our turn to identify before dialing, as the connection
+		// would time out while waiting
+		if err := gw.identifies.acquire(gw.done, gw.shardID); err != nil {
+			return err
+		}
+		url = bot.URL
+	}
+
+	url += "?v=9"
+	if gw.compress {
+		url += "&compress=zlib-stream"
+	}
+
+	fmt.Printf("Connecting to Gateway URL = %+v\n", url)
+	wsc, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to dial websocket: %w", err)
+	}
+	gw.Lock()
+	defer gw.Unlock()
+	gw.wsc = wsc
+	if gw.compress {
+		gw.inflater = newZlibStream()
+	}
+	gw.limiter.reset() // the rate limit applies per connection
+	return nil
+}
+
+// writer owns all writes to the websocket. Heartbeats are always sent first
+// and regular commands are delayed to stay within the send rate limit.
+func (gw *gateway) writer() {
+	for {
+		// select picks a random ready case, so check for heartbeats first to
+		// not delay them behind a queue of regular commands
+		select {
+		case msg := <-gw.heartbeats:
+			msg.result <- gw.write(msg.payload)
+			continue
+		default:
+		}
+		select {
+		case <-gw.done:
+			return
+		case msg := <-gw.heartbeats:
+			msg.result <- gw.write(msg.payload)
+		case msg := <-gw.outbox:
+			gw.waitForLimit()
+			msg.result <- gw.write(msg.payload)
+		}
+	}
+}
+
+// waitForLimit blocks until a regular command may be sent while still
+// sending any heartbeats that are due
+func (gw *gateway) waitForLimit() {
+	for {
+		gw.Lock()
+		wait := gw.limiter.delay(time.Now())
+		gw.Unlock()
+		if wait <= 0 {
+			return
+		}
+		fmt.Printf("Hit gateway rate limit, waiting for %v\n", wait)
+		select {
+		case <-gw.done:
+			return
+		case msg := <-gw.heartbeats:
+			msg.result <- gw.write(msg.payload)
+		case <-time.After(wait):
+		}
+	}
+}
+
+// disconnect closes the current connection, if any
+func (gw *gateway) disconnect() {
+	gw.Lock()
+	if gw.stopHeartbeat != nil {
+		gw.stopHeartbeat()
+	}
+	if gw.wsc != nil {
+		gw.wsc.Close()
+		gw.wsc = nil
+	}
+	if gw.inflater != nil {
+		gw.inflater.Close()
+		gw.inflater = nil
+	}
+	gw.Unlock()
+	gw.setState(gatewayDisconnected)
 }
 
 func (gw *gateway) Close() {
-	gw.wsc.Close()
+	gw.disconnect()
 }
 
+// serve reads from the current connection until it fails or Discord asks us
+// to reconnect
+func (gw *gateway) serve(handle func(*wsPayload)) error {
+	for {
+		message, err := gw.ReadMessage()
+		if err != nil {
+			return fmt.Errorf("reading message: %w", err)
+		}
+		payload := &wsPayload{}
+		err = json.Unmarshal(message, payload)
+		gw.track(payload) // the sequence number is set even for dispatches we fail to parse
+		if err != nil {
+			fmt.Printf("Failed to parse message (follows); err is %+v\n\t%s\n", payload, message)
+			continue
+		}
+
+		switch d := payload.D.(type) {
+		case *opHello:
+			fmt.Printf("Recieve: Hello Payload with HeartbeatInterval %v\n", d.HeartbeatInterval)
+			gw.startHeartbeat(d.HeartbeatInterval)
+			if gw.canResume() {
+				err = gw.resume()
+			} else {
+				err = gw.identify()
+			}
+			if err != nil {
+				return err
+			}
+		case *opHeartbeat:
+			fmt.Println("Recieve: Heartbeat request")
+			if err := gw.heartbeat(); err != nil {
+				return fmt.Errorf("sending heartbeat: %w", err)
+			}
+		case *opHeartbeatACK:
+			fmt.Println("Recieve: Heartbeat ACK")
+			gw.heartbeatACK()
+		case *opReconnect:
+			fmt.Println("Recieve: Reconnect")
+			return errReconnect
+		case *opInvalidSession:
+			fmt.Printf("Recieve: Invalid Session, resumable = %v\n", d.Resumable)
+			if d.Resumable && gw.canResume() {
+				// Resuming has to happen on a new connection to the resume URL
+				return errReconnect
+			}
+			gw.invalidateSession()
+			// Discord asks us to wait a random amount of time between 1 and 5 seconds
+			time.Sleep(time.Second + time.Duration(rand.Int63n(int64(4*time.Second))))
+			if err := gw.identifies.acquire(gw.done, gw.shardID); err != nil {
+				return err
+			}
+			if err := gw.identify(); err != nil {
+				return err
+			}
+		case *dispatchReady:
+			gw.setState(gatewayConnected)
+			handle(payload)
+		case *dispatchResumed:
+			fmt.Println("Recieve Dispatch: RESUMED")
+			gw.setState(gatewayConnected)
+		default:
+			if payload.OP == 0 {
+				handle(payload)
+			} else {
+				fmt.Printf("Recieve: Unsupported payload: %+v\nD: %+v\n", payload, payload.D)
+			}
+		}
+	}
+}
+
+func (gw *gateway) setState(state gatewayState) {
+	gw.Lock()
+	defer gw.Unlock()
+	if gw.state == state {
+		return
+	}
+	fmt.Printf("Gateway shard %d/%d is %s\n", gw.shardID, gw.shardCount, state)
+	gw.state = state
+	if state == gatewayConnected {
+		gw.backoff.reset()
+	}
+	publishState(gw.subscribers, state)
+}
+
+// publishState sends state to the subscribers. Only the latest state is
+// interesting, so any unread state is replaced.
+func publishState(subscribers []chan gatewayState, state gatewayState) {
+	for _, sub := range subscribers {
+		select {
+		case <-sub:
+		default:
+		}
+		sub <- state
+	}
+}
+
+func (gw *gateway) connected() bool {
+	gw.Lock()
+	defer gw.Unlock()
+	return gw.state == gatewayConnected
+}
+
+// subscribe returns a channel which receives the latest state of the gateway
+// connection whenever it changes
+func (gw *gateway) subscribe() <-chan gatewayState {
+	gw.Lock()
+	defer gw.Unlock()
+	sub := make(chan gatewayState, 1)
+	gw.subscribers = append(gw.subscribers, sub)
+	return sub
+}
+
+// startHeartbeat sends heartbeats on the current connection until it is
+// replaced. If a heartbeat is not acknowledged before the next one is due the
+// connection is considered a zombie and closed, which makes the read loop
+// reconnect and resume.
+func (gw *gateway) startHeartbeat(interval time.Duration) {
+	gw.Lock()
+	if gw.stopHeartbeat != nil {
+		gw.stopHeartbeat()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	gw.stopHeartbeat = cancel
+	gw.acked = true
+	wsc := gw.wsc
+	gw.Unlock()
+
+	go func() {
+		// The first heartbeat should be sent after interval * jitter, see
+		// https://discord.com/developers/docs/topics/gateway#sending-heartbeats
+		wait := time.Duration(rand.Float64() * float64(interval))
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+			wait = interval
+
+			gw.Lock()
+			acked := gw.acked
+			gw.acked = false
+			gw.Unlock()
+			if !acked {
+				fmt.Println("No Heartbeat ACK received, closing zombie connection")
+				wsc.Close()
+				return
+			}
+			if err := gw.heartbeat(); err != nil {
+				// The read loop notices broken connections and reconnects
+				fmt.Printf("Failed to send heartbeat: %+v\n", err)
+			}
+		}
+	}()
+}
+
+func (gw *gateway) heartbeat() error {
+	gw.Lock()
+	seq := gw.seq
+	gw.Unlock()
+	return gw.writeJSONMessage(wsPayload{
+		OP: 1,
+		D:  seq,
+	})
+}
+
+func (gw *gateway) heartbeatACK() {
+	gw.Lock()
+	defer gw.Unlock()
+	gw.acked = true
+}
+
+func (gw *gateway) conn() *websocket.Conn {
+	gw.Lock()
+	defer gw.Unlock()
+	return gw.wsc
+}
+
+// ReadMessage returns the next complete message, inflating it if transport
+// compression is used
 func (gw *gateway) ReadMessage() ([]byte, error) {
-	_, message, err := gw.wsc.ReadMessage()
-	return message, err
+	gw.Lock()
+	wsc := gw.wsc
+	inflater := gw.inflater
+	gw.Unlock()
+	if wsc == nil {
+		return nil, errNotConnected
+	}
+	for {
+		_, message, err := wsc.ReadMessage()
+		if err != nil || inflater == nil {
+			return message, err
+		}
+		message, err = inflater.feed(message)
+		if err != nil {
+			return nil, err
+		}
+		if message != nil {
+			return message, nil
+		}
+	}
+}
+
+// track records the sequence number and the session details of a received
+// payload so that the session can be resumed later
+func (gw *gateway) track(payload *wsPayload) {
+	gw.Lock()
+	defer gw.Unlock()
+	if payload.Seq != nil {
+		gw.seq = payload.Seq
+	}
+	if ready, ok := payload.D.(*dispatchReady); ok {
+		gw.sessionID = ready.Session_id
+		gw.resumeURL = ready.ResumeGatewayURL
+	}
+}
+
+// invalidateSession forgets the current session so the next Hello results in
+// a fresh Identify
+func (gw *gateway) invalidateSession() {
+	gw.Lock()
+	defer gw.Unlock()
+	gw.sessionID = ""
+	gw.resumeURL = ""
+	gw.seq = nil
+}
+
+func (gw *gateway) canResume() bool {
+	gw.Lock()
+	defer gw.Unlock()
+	return gw.sessionID != "" && gw.seq != nil
 }
 
+// identify starts a new session, the caller has to acquire an Identify from
+// the identify limiter first
+func (gw *gateway) identify() error {
+	var shard []int
+	if gw.shardCount > 1 {
+		shard = []int{gw.shardID, gw.shardCount}
+	}
+	var presence *opUpdatePresence
+	if gw.presence != nil {
+		presence = gw.presence()
+	}
+	return gw.writeJSONMessage(wsPayload{
+		OP: 2,
+		D: opIdentify{
+			Token: gw.token,
+			Properties: identifyProperties{
+				OS:      "linux",
+				Browser: "discraft",
+				Device:  "discraft",
+			},
+			Intents:  gw.intents,
+			Shard:    shard,
+			Presence: presence,
+		},
+	})
+}
+
+func (gw *gateway) resume() error {
+	gw.Lock()
+	resume := opResume{
+		Token:     gw.token,
+		SessionID: gw.sessionID,
+		Seq:       *gw.seq,
+	}
+	gw.Unlock()
+	return gw.writeJSONMessage(wsPayload{
+		OP: 6,
+		D:  resume,
+	})
+}
+
+// writeJSONMessage queues msg for the writer goroutine and waits until it has
+// been sent
 func (gw *gateway) writeJSONMessage(msg wsPayload) error {
+	queue := gw.outbox
+	if msg.OP == 1 { // Heartbeat
+		queue = gw.heartbeats
+	}
+	out := outbound{
+		payload: msg,
+		result:  make(chan error, 1),
+	}
+	select {
+	case <-gw.done:
+		return errGatewayClosed
+	case queue <- out:
+	}
+	select {
+	case <-gw.done:
+		return errGatewayClosed
+	case err := <-out.result:
+		return err
+	}
+}
+
+func (gw *gateway) write(msg wsPayload) error {
 	data, err := json.Marshal(msg)
 	if err != nil {
 		return fmt.Errorf("marshaling message: %w", err)
 	}
-	if msg.OP == 2 { // Identify, don't print token
+	switch msg.OP {
+	case 2: // Identify, don't print token
 		fmt.Printf("Send: opIdentify (censored)\n")
-	} else {
+	case 6: // Resume, don't print token
+		fmt.Printf("Send: opResume (censored)\n")
+	default:
 		fmt.Printf("Send: %s\n", data)
 	}
-	if err := gw.wsc.WriteMessage(websocket.TextMessage, data); err != nil {
+	gw.Lock()
+	wsc := gw.wsc
+	if wsc != nil {
+		gw.limiter.record(time.Now())
+	}
+	gw.Unlock()
+	if wsc == nil {
+		return errNotConnected
+	}
+	if err := wsc.WriteMessage(websocket.TextMessage, data); err != nil {
 		return fmt.Errorf("writing message: %w", err)
 	}
 	return nil
@@ -71,28 +672,29 @@ func (wsp *wsPayload) UnmarshalJSON(data []byte) error {
 	wsp.T = v.T
 	switch wsp.OP {
 	case 0: // Dispatch
-		switch wsp.T {
-		case "READY":
-			wsp.D = &dispatchReady{}
-		case "MESSAGE_CREATE":
-			wsp.D = &dispatchMessageCreate{}
-		case "CHANNEL_CREATE":
-			wsp.D = &dispatchChannelCreate{}
-		default:
-			return fmt.Errorf("parsing unknown Dispatch type %q", wsp.T)
+		newEvent, ok := dispatchEvents[wsp.T]
+		if !ok {
+			wsp.D = &dispatchUnknown{
+				Name: wsp.T,
+				Data: v.D,
+			}
+			return nil
 		}
+		wsp.D = newEvent()
 	case 1: // Hearbeat
 		wsp.D = &opHeartbeat{}
 	case 7:
 		wsp.D = &opReconnect{}
+	case 9: // Invalid Session
+		wsp.D = &opInvalidSession{}
 	case 10: // Hello
 		wsp.D = &opHello{}
 	case 11: // Heartbeat ACK
 		wsp.D = &opHeartbeatACK{}
 	}
-	if wsp.D != nil {
+	if wsp.D != nil && len(v.D) > 0 {
 		if err := json.Unmarshal(v.D, wsp.D); err != nil {
-			return fmt.Errorf("failed to parse Hello (opcode 10): %w", err)
+			return fmt.Errorf("failed to parse opcode %d: %w", wsp.OP, err)
 		}
 	}
 	return nil
@@ -117,14 +719,30 @@ type opHeartbeat struct{}
 
 type opReconnect struct{}
 
+// https://discord.com/developers/docs/topics/gateway#invalid-session
+type opInvalidSession struct {
+	Resumable bool // whether the session may be resumed
+}
+
+func (p *opInvalidSession) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &p.Resumable)
+}
+
 type opIdentify struct {
-	Token           string             `json:"token"`           //	authentication token	-
-	Properties      identifyProperties `json:"properties"`      //	connection properties	-
-	Compres         bool               `json:"compress"`        // boolean	whether this connection supports compression of packets	false
-	Large_threshold *int               `json:"large_threshold"` //dinteger	value between 50 and 250, total number of members where the gateway will stop sending offline members in the guild member list	50
-	Shard           []int              `json:"shard,omitempty"` //darray of two integers (shard_id, num_shards)	used for Guild Sharding	-
-	// Presence object`json:"presence"` //eupdate presence object	presence structure for initial presence information	-
-	Intents int `json:"intents"` //	the Gateway Intents you wish to receive	-
+	Token           string             `json:"token"`              //	authentication token	-
+	Properties      identifyProperties `json:"properties"`         //	connection properties	-
+	Compres         bool               `json:"compress"`           // boolean	whether this connection supports compression of packets	false
+	Large_threshold *int               `json:"large_threshold"`    //dinteger	value between 50 and 250, total number of members where the gateway will stop sending offline members in the guild member list	50
+	Shard           []int              `json:"shard,omitempty"`    //darray of two integers (shard_id, num_shards)	used for Guild Sharding	-
+	Presence        *opUpdatePresence  `json:"presence,omitempty"` // presence structure for initial presence information
+	Intents         int                `json:"intents"`            //	the Gateway Intents you wish to receive	-
+}
+
+// https://discord.com/developers/docs/topics/gateway#resume
+type opResume struct {
+	Token     string `json:"token"`      // session token
+	SessionID string `json:"session_id"` // session id
+	Seq       int    `json:"seq"`        // last sequence number received
 }
 
 type identifyProperties struct {
@@ -135,7 +753,7 @@ type identifyProperties struct {
 
 // https://discord.com/developers/docs/topics/gateway#update-presence
 type opUpdatePresence struct {
-	Since      int              `json:"since"`
+	Since      *int             `json:"since"` // unix time (in milliseconds) of when the client went idle, or null if the client is not idle
 	Activities []activityObject `json:"activities"`
 	// https://discord.com/developers/docs/topics/gateway#update-presence-status-types
 	Status string `json:"status"` // can be one of online, dnd, idle, invisible, offline
@@ -144,21 +762,78 @@ type opUpdatePresence struct {
 
 // https://discord.com/developers/docs/topics/gateway#activity-object
 type activityObject struct {
-	Name string `json:"name"`
-	Type int    `json:"type"`
-	URL  string `json:"url,omitempty"`
+	Name  string `json:"name"`
+	Type  int    `json:"type"`
+	URL   string `json:"url,omitempty"`
+	State string `json:"state,omitempty"` // the user's current party status, or text used for a custom status
 }
 
 type dispatchReady struct {
-	V int `json:"v"` //	gateway version
-	// User	user `json:"user"` //	object	information about the user including email
-	// Guilds	array of Unavailable Guild objects	`json:"guilds"`// the guilds the user is in
-	Session_id  string         `json:"session_id"`       //	used for resuming connections
-	Shard       []int          `json:"shard",omitempty"` // array of two integers (shard_id, num_shards)	the shard information associated with this session, if sent when identifying
-	Application applicationObj `json:"application"`      //	contains id and flags
+	V                int                   `json:"v"`                  //	gateway version
+	User             userObj               `json:"user"`               //	information about the user including email
+	Guilds           []unavailableGuildObj `json:"guilds"`             // the guilds the user is in
+	Session_id       string                `json:"session_id"`         //	used for resuming connections
+	ResumeGatewayURL string                `json:"resume_gateway_url"` // gateway url for resuming connections
+	Shard            []int                 `json:"shard,omitempty"`    // array of two integers (shard_id, num_shards)	the shard information associated with this session, if sent when identifying
+	Application      applicationObj        `json:"application"`        //	contains id and flags
 }
 
+// https://discord.com/developers/docs/topics/gateway#resumed
+type dispatchResumed struct{}
+
 // https://discord.com/developers/docs/topics/gateway#message-create
 type dispatchMessageCreate = messageObj
 
 type dispatchChannelCreate channelObj
+
+// https://discord.com/developers/docs/topics/gateway#channel-update
+type dispatchChannelUpdate channelObj
+
+// https://discord.com/developers/docs/topics/gateway#channel-delete
+type dispatchChannelDelete channelObj
+
+// https://discord.com/developers/docs/topics/gateway#guild-create
+type dispatchGuildCreate struct {
+	guildObj
+	Members  []guildMemberObj `json:"members"`  // users in the guild
+	Channels []channelObj     `json:"channels"` // channels in the guild
+}
+
+// https://discord.com/developers/docs/topics/gateway#guild-update
+type dispatchGuildUpdate guildObj
+
+// https://discord.com/developers/docs/topics/gateway#guild-delete
+type dispatchGuildDelete unavailableGuildObj
+
+// https://discord.com/developers/docs/topics/gateway#guild-member-add
+type dispatchGuildMemberAdd struct {
+	guildMemberObj
+	GuildID snowflake `json:"guild_id"` // id of the guild
+}
+
+// https://discord.com/developers/docs/topics/gateway#guild-member-update
+type dispatchGuildMemberUpdate dispatchGuildMemberAdd
+
+// https://discord.com/developers/docs/topics/gateway#guild-member-remove
+type dispatchGuildMemberRemove struct {
+	GuildID snowflake `json:"guild_id"` // the id of the guild
+	User    userObj   `json:"user"`     // the user who was removed
+}
+
+// https://discord.com/developers/docs/topics/gateway#guild-role-create
+type dispatchGuildRoleCreate struct {
+	GuildID snowflake `json:"guild_id"` // the id of the guild
+	Role    roleObj   `json:"role"`     // the role created
+}
+
+// https://discord.com/developers/docs/topics/gateway#guild-role-update
+type dispatchGuildRoleUpdate dispatchGuildRoleCreate
+
+// https://discord.com/developers/docs/topics/gateway#guild-role-delete
+type dispatchGuildRoleDelete struct {
+	GuildID snowflake `json:"guild_id"` // id of the guild
+	RoleID  snowflake `json:"role_id"`  // id of the role
+}
+
+// https://discord.com/developers/docs/topics/gateway-events#interaction-create
+type dispatchInteractionCreate interactionObj
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestSendLimiter(t *testing.T) {
+	start := time.Unix(1600000000, 0)
+	tests := []struct {
+		name  string
+		sends []time.Duration // offsets from start of the recorded sends
+		now   time.Duration
+		delay time.Duration
+	}{
+		{"empty", nil, 0, 0},
+		{"below limit", []time.Duration{0, time.Second, 2 * time.Second, 3 * time.Second}, 4 * time.Second, 0},
+		{"at limit", []time.Duration{0, time.Second, 2 * time.Second, 3 * time.Second, 4 * time.Second}, 5 * time.Second, 5 * time.Second},
+		{"oldest expired", []time.Duration{0, time.Second, 2 * time.Second, 3 * time.Second, 4 * time.Second}, 10 * time.Second, 0},
+		{"over limit", []time.Duration{0, time.Second, 2 * time.Second, 3 * time.Second, 4 * time.Second, 5 * time.Second, 6 * time.Second}, 7 * time.Second, 5 * time.Second},
+	}
+	for _, test := range tests {
+		// 10 sends per 10s leaves 5 for regular commands after the heartbeat reserve
+		l := sendLimiter{limit: 10, window: 10 * time.Second}
+		for _, send := range test.sends {
+			l.record(start.Add(send))
+		}
+		if delay := l.delay(start.Add(test.now)); delay != test.delay {
+			t.Errorf("%s: delay = %v, want %v", test.name, delay, test.delay)
+		}
+	}
+}
+
+func TestSendLimiterPrunes(t *testing.T) {
+	start := time.Unix(1600000000, 0)
+	l := sendLimiter{limit: 10, window: 10 * time.Second}
+	for i := 0; i < 20; i++ {
+		l.record(start.Add(time.Duration(i) * time.Second))
+	}
+	if len(l.sent) != 10 {
+		t.Errorf("len(sent) = %d, want 10", len(l.sent))
+	}
+}
+
+func TestPayloadUnmarshal(t *testing.T) {
+	tests := []struct {
+		data string
+		want any
+	}{
+		{`{"op":9,"d":true}`, &opInvalidSession{Resumable: true}},
+		{`{"op":9,"d":false}`, &opInvalidSession{Resumable: false}},
+		{`{"op":10,"d":{"heartbeat_interval":41250}}`, &opHello{HeartbeatInterval: 41250 * time.Millisecond}},
+		{`{"op":11}`, &opHeartbeatACK{}},
+		{`{"op":7,"d":null}`, &opReconnect{}},
+		{`{"op":0,"s":1,"t":"RESUMED","d":{}}`, &dispatchResumed{}},
+		{`{"op":0,"s":2,"t":"TYPING_START","d":{"x":1}}`, &dispatchUnknown{Name: "TYPING_START", Data: json.RawMessage(`{"x":1}`)}},
+	}
+	for _, test := range tests {
+		payload := &wsPayload{}
+		if err := json.Unmarshal([]byte(test.data), payload); err != nil {
+			t.Errorf("Unmarshal(%s) failed: %+v", test.data, err)
+			continue
+		}
+		got, _ := json.Marshal(payload.D)
+		want, _ := json.Marshal(test.want)
+		if fmt.Sprintf("%T", payload.D) != fmt.Sprintf("%T", test.want) || string(got) != string(want) {
+			t.Errorf("Unmarshal(%s).D = %T %s, want %T %s", test.data, payload.D, got, test.want, want)
+		}
+	}
+}
+
+func TestSessionTracking(t *testing.T) {
+	gw := newGateway(nil, "token", 0, false)
+	if gw.canResume() {
+		t.Error("canResume() before READY")
+	}
+
+	ready := &wsPayload{}
+	if err := json.Unmarshal([]byte(`{"op":0,"s":1,"t":"READY","d":{"session_id":"abc","resume_gateway_url":"wss://resume.example"}}`), ready); err != nil {
+		t.Fatal(err)
+	}
+	gw.track(ready)
+	seq := 5
+	gw.track(&wsPayload{OP: 0, Seq: &seq, T: "MESSAGE_CREATE"})
+	gw.track(&wsPayload{OP: 11}) // without a sequence number
+	if !gw.canResume() || gw.sessionID != "abc" || gw.resumeURL != "wss://resume.example" || *gw.seq != 5 {
+		t.Errorf("after READY: canResume() = %v, session %q, resume URL %q, seq %v", gw.canResume(), gw.sessionID, gw.resumeURL, *gw.seq)
+	}
+
+	gw.invalidateSession()
+	if gw.canResume() || gw.sessionID != "" || gw.resumeURL != "" || gw.seq != nil {
+		t.Errorf("after invalidateSession: canResume() = %v, session %q, resume URL %q", gw.canResume(), gw.sessionID, gw.resumeURL)
+	}
+}
+
+func TestHandleClose(t *testing.T) {
+	tests := []struct {
+		code          int
+		unrecoverable bool
+		keepsSession  bool
+	}{
+		{1001, false, true},
+		{4000, false, true}, // Unknown error
+		{4004, true, true},  // Authentication failed
+		{4007, false, false},
+		{4009, false, false},
+		{4013, true, true},
+		{4014, true, true},
+	}
+	for _, test := range tests {
+		gw := newGateway(nil, "token", INTENT_GUILDS|INTENT_MESSAGE_CONTENT, false)
+		seq := 1
+		gw.sessionID = "abc"
+		gw.seq = &seq
+
+		err := gw.handleClose(&websocket.CloseError{Code: test.code, Text: "closed"})
+		if errors.Is(err, errUnrecoverable) != test.unrecoverable {
+			t.Errorf("handleClose(%d) = %v, want unrecoverable %v", test.code, err, test.unrecoverable)
+		}
+		if gw.canResume() != test.keepsSession {
+			t.Errorf("handleClose(%d): canResume() = %v, want %v", test.code, gw.canResume(), test.keepsSession)
+		}
+	}
+}
+
+// fakeGateway runs script on the server side of every websocket connection
+func fakeGateway(t *testing.T, script func(wsc *websocket.Conn)) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wsc, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrading: %+v", err)
+			return
+		}
+		defer wsc.Close()
+		script(wsc)
+	}))
+}
+
+// resumingGateway returns a gateway with a session to resume at server
+func resumingGateway(server *httptest.Server) *gateway {
+	gw := newGateway(nil, "token", 0, false)
+	seq := 5
+	gw.sessionID = "abc"
+	gw.resumeURL = "ws" + strings.TrimPrefix(server.URL, "http")
+	gw.seq = &seq
+	go gw.writer()
+	return gw
+}
+
+func TestGatewayResume(t *testing.T) {
+	tests := []struct {
+		name string
+		last string // sent by the server after RESUMED
+	}{
+		{"reconnect", `{"op":7,"d":null}`},
+		// A resumable Invalid Session redials the resume URL instead of
+		// resuming on the same connection
+		{"invalid session", `{"op":9,"d":true}`},
+	}
+	for _, test := range tests {
+		resumed := make(chan opResume, 1)
+		server := fakeGateway(t, func(wsc *websocket.Conn) {
+			wsc.WriteMessage(websocket.TextMessage, []byte(`{"op":10,"d":{"heartbeat_interval":45000}}`))
+			var payload struct {
+				OP int      `json:"op"`
+				D  opResume `json:"d"`
+			}
+			if err := wsc.ReadJSON(&payload); err != nil || payload.OP != 6 {
+				t.Errorf("%s: expected a Resume, got op %d: %v", test.name, payload.OP, err)
+				return
+			}
+			resumed <- payload.D
+			wsc.WriteMessage(websocket.TextMessage, []byte(`{"op":0,"s":6,"t":"RESUMED","d":{}}`))
+			wsc.WriteMessage(websocket.TextMessage, []byte(test.last))
+			wsc.ReadMessage() // until the client hangs up
+		})
+
+		gw := resumingGateway(server)
+		if err := gw.connect(); err != nil {
+			t.Fatal(err)
+		}
+		err := gw.serve(func(*wsPayload) {})
+		gw.disconnect()
+		close(gw.done)
+		server.Close()
+
+		if !errors.Is(err, errReconnect) {
+			t.Errorf("%s: serve() = %v, want %v", test.name, err, errReconnect)
+		}
+		select {
+		case resume := <-resumed:
+			if resume.SessionID != "abc" || resume.Seq != 5 || resume.Token != "token" {
+				t.Errorf("%s: resumed with %+v", test.name, resume)
+			}
+		default:
+			t.Errorf("%s: no Resume was sent", test.name)
+		}
+		if !gw.canResume() || *gw.seq != 6 {
+			t.Errorf("%s: canResume() = %v with seq %d after RESUMED", test.name, gw.canResume(), *gw.seq)
+		}
+	}
+}
+
+func TestGatewayZombieConnection(t *testing.T) {
+	heartbeats := make(chan *int, 1)
+	server := fakeGateway(t, func(wsc *websocket.Conn) {
+		wsc.WriteMessage(websocket.TextMessage, []byte(`{"op":10,"d":{"heartbeat_interval":20}}`))
+		// Read the Resume and the heartbeats, but never acknowledge them
+		for {
+			var payload struct {
+				OP int             `json:"op"`
+				D  json.RawMessage `json:"d"`
+			}
+			if err := wsc.ReadJSON(&payload); err != nil {
+				return
+			}
+			if payload.OP == 1 {
+				var seq *int
+				json.Unmarshal(payload.D, &seq)
+				select {
+				case heartbeats <- seq:
+				default:
+				}
+			}
+		}
+	})
+	defer server.Close()
+
+	gw := resumingGateway(server)
+	defer close(gw.done)
+	if err := gw.connect(); err != nil {
+		t.Fatal(err)
+	}
+	result := make(chan error, 1)
+	go func() {
+		result <- gw.serve(func(*wsPayload) {})
+	}()
+	select {
+	case err := <-result:
+		if err == nil || errors.Is(err, errReconnect) {
+			t.Errorf("serve() = %v, want a read error from the closed connection", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the zombie connection was not closed")
+	}
+	gw.disconnect()
+
+	// Heartbeats carry the last sequence number
+	select {
+	case seq := <-heartbeats:
+		if seq == nil || *seq != 5 {
+			t.Errorf("heartbeat sent with sequence number %v, want 5", seq)
+		}
+	case <-time.After(time.Second):
+		t.Error("no heartbeat was sent")
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// identifyReserve is the number of session starts we never use, leaving some
+// room for manual restarts
+const identifyReserve = 5
+
+// identifyInterval is how often each of the max_concurrency buckets may
+// identify, see https://discord.com/developers/docs/topics/gateway#sharding-max-concurrency
+const identifyInterval = 5 * time.Second
+
+// identifyLimiter keeps track of the session start limit so that a crash loop
+// can not use up the daily Identify budget, which would get the token reset.
+// It is shared by all shards, which also have to take turns identifying.
+// See https://discord.com/developers/docs/topics/gateway#session-start-limit-object
+type identifyLimiter struct {
+	sync.Mutex
+	limit    *sessionStartLimit // nil until fetched from /gateway/bot
+	resetAt  time.Time
+	interval time.Duration     // how often each bucket may identify
+	last     map[int]time.Time // latest identify of each max_concurrency bucket
+}
+
+func newIdentifyLimiter() *identifyLimiter {
+	return &identifyLimiter{
+		interval: identifyInterval,
+		last:     map[int]time.Time{},
+	}
+}
+
+func (l *identifyLimiter) update(limit sessionStartLimit) {
+	l.Lock()
+	defer l.Unlock()
+	l.limit = &limit
+	l.resetAt = time.Now().Add(time.Duration(limit.ResetAfter) * time.Millisecond)
+	if limit.Remaining < limit.Total/10 {
+		fmt.Printf("Warning: only %d of %d session starts remain until %v\n", limit.Remaining, limit.Total, l.resetAt)
+	}
+}
+
+// wait blocks until an Identify is within the budget
+func (l *identifyLimiter) wait(done <-chan struct{}) error {
+	for {
+		l.Lock()
+		if l.limit == nil || l.limit.Remaining > identifyReserve {
+			l.Unlock()
+			return nil
+		}
+		if !time.Now().Before(l.resetAt) {
+			l.limit.Remaining = l.limit.Total
+			l.Unlock()
+			continue
+		}
+		remaining, total, wait := l.limit.Remaining, l.limit.Total, time.Until(l.resetAt)
+		l.Unlock()
+
+		fmt.Printf("Only %d of %d session starts remain, waiting %v for the limit to reset instead of identifying. Is discraft restarting in a loop?\n", remaining, total, wait)
+		select {
+		case <-done:
+			return errGatewayClosed
+		case <-time.After(wait):
+		}
+	}
+}
+
+// acquire waits until the shard may identify and takes the Identify from the
+// budget
+func (l *identifyLimiter) acquire(done <-chan struct{}, shardID int) error {
+	if err := l.wait(done); err != nil {
+		return err
+	}
+	for {
+		l.Lock()
+		maxConcurrency := 1
+		if l.limit != nil && l.limit.MaxConcurrency > 0 {
+			maxConcurrency = l.limit.MaxConcurrency
+		}
+		bucket := shardID % maxConcurrency
+		wait := time.Until(l.last[bucket].Add(l.interval))
+		if wait <= 0 {
+			l.last[bucket] = time.Now()
+			if l.limit != nil {
+				l.limit.Remaining--
+			}
+			l.Unlock()
+			return nil
+		}
+		l.Unlock()
+
+		select {
+		case <-done:
+			return errGatewayClosed
+		case <-time.After(wait):
+		}
+	}
+}
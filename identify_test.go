@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestIdentifyLimiterWait(t *testing.T) {
+	tests := []struct {
+		name      string
+		limit     *sessionStartLimit
+		resetIn   time.Duration
+		minWait   time.Duration
+		remaining int // Remaining after wait, if limit is set
+	}{
+		{"no limit fetched", nil, 0, 0, 0},
+		{"above reserve", &sessionStartLimit{Total: 1000, Remaining: identifyReserve + 1}, time.Hour, 0, identifyReserve + 1},
+		{"reserve reached", &sessionStartLimit{Total: 1000, Remaining: identifyReserve}, 50 * time.Millisecond, 50 * time.Millisecond, 1000},
+		{"already reset", &sessionStartLimit{Total: 1000, Remaining: 0}, -time.Second, 0, 1000},
+	}
+	for _, test := range tests {
+		l := newIdentifyLimiter()
+		l.limit = test.limit
+		l.resetAt = time.Now().Add(test.resetIn)
+
+		start := time.Now()
+		if err := l.wait(make(chan struct{})); err != nil {
+			t.Errorf("%s: wait() = %v", test.name, err)
+		}
+		if waited := time.Since(start); waited < test.minWait || waited > test.minWait+time.Second {
+			t.Errorf("%s: waited %v, want about %v", test.name, waited, test.minWait)
+		}
+		if l.limit != nil && l.limit.Remaining != test.remaining {
+			t.Errorf("%s: Remaining = %d, want %d", test.name, l.limit.Remaining, test.remaining)
+		}
+	}
+}
+
+func TestIdentifyLimiterWaitDone(t *testing.T) {
+	l := newIdentifyLimiter()
+	l.limit = &sessionStartLimit{Total: 1000, Remaining: 0}
+	l.resetAt = time.Now().Add(time.Hour)
+	done := make(chan struct{})
+	close(done)
+	if err := l.wait(done); !errors.Is(err, errGatewayClosed) {
+		t.Errorf("wait() = %v, want %v", err, errGatewayClosed)
+	}
+}
+
+func TestIdentifyLimiterAcquire(t *testing.T) {
+	const interval = 50 * time.Millisecond
+	tests := []struct {
+		name           string
+		maxConcurrency int
+		shards         []int
+		minWait        time.Duration
+	}{
+		{"one shard", 1, []int{0}, 0},
+		{"same bucket", 1, []int{0, 1, 2}, 2 * interval},
+		{"separate buckets", 2, []int{0, 1}, 0},
+		{"shared bucket", 2, []int{0, 1, 2}, interval},
+	}
+	for _, test := range tests {
+		l := newIdentifyLimiter()
+		l.interval = interval
+		l.limit = &sessionStartLimit{Total: 1000, Remaining: 100, MaxConcurrency: test.maxConcurrency}
+		l.resetAt = time.Now().Add(time.Hour)
+
+		start := time.Now()
+		for _, shard := range test.shards {
+			if err := l.acquire(make(chan struct{}), shard); err != nil {
+				t.Errorf("%s: acquire(%d) = %v", test.name, shard, err)
+			}
+		}
+		if waited := time.Since(start); waited < test.minWait || waited > test.minWait+time.Second {
+			t.Errorf("%s: waited %v, want about %v", test.name, waited, test.minWait)
+		}
+		if want := 100 - len(test.shards); l.limit.Remaining != want {
+			t.Errorf("%s: Remaining = %d, want %d", test.name, l.limit.Remaining, want)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// features are the optional parts of discraft which need privileged gateway
+// intents, so they have to be enabled with DISCRAFT_FEATURES
+type features struct {
+	members        bool // track guild members, for nicknames and roles
+	presences      bool // receive presence updates of guild members
+	messageContent bool // read the content of all messages, not only the ones mentioning discraft
+}
+
+var featureNames = map[string]func(*features){
+	"members":         func(f *features) { f.members = true },
+	"presences":       func(f *features) { f.presences = true },
+	"message-content": func(f *features) { f.messageContent = true },
+}
+
+// parseFeatures parses a comma separated list of feature names
+func parseFeatures(list string) (features, error) {
+	var f features
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		enable, ok := featureNames[name]
+		if !ok {
+			names := []string{}
+			for name := range featureNames {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return f, fmt.Errorf("unknown feature %q, known features are %s", name, strings.Join(names, ", "))
+		}
+		enable(&f)
+	}
+	return f, nil
+}
+
+// intents returns the privileged intents of the enabled features, the other
+// intents follow from the subscribed events
+func (f features) intents() int {
+	intents := 0
+	if f.members {
+		intents |= INTENT_GUILD_MEMBERS
+	}
+	if f.presences {
+		intents |= INTENT_GUILD_PRESENCES
+	}
+	if f.messageContent {
+		intents |= INTENT_MESSAGE_CONTENT
+	}
+	return intents
+}
+
+// eventIntents are the gateway intents needed to receive the dispatch events,
+// events which are not listed are sent without any intent, see
+// https://discord.com/developers/docs/topics/gateway#list-of-intents
+//
+// The privileged intents of events which discraft only subscribes to when a
+// feature is enabled are also listed. Messages mentioning discraft carry
+// their content without the message content intent.
+var eventIntents = map[string]int{
+	"GUILD_CREATE":        INTENT_GUILDS,
+	"GUILD_UPDATE":        INTENT_GUILDS,
+	"GUILD_DELETE":        INTENT_GUILDS,
+	"GUILD_ROLE_CREATE":   INTENT_GUILDS,
+	"GUILD_ROLE_UPDATE":   INTENT_GUILDS,
+	"GUILD_ROLE_DELETE":   INTENT_GUILDS,
+	"CHANNEL_CREATE":      INTENT_GUILDS,
+	"CHANNEL_UPDATE":      INTENT_GUILDS,
+	"CHANNEL_DELETE":      INTENT_GUILDS,
+	"GUILD_MEMBER_ADD":    INTENT_GUILD_MEMBERS,
+	"GUILD_MEMBER_UPDATE": INTENT_GUILD_MEMBERS,
+	"GUILD_MEMBER_REMOVE": INTENT_GUILD_MEMBERS,
+	"PRESENCE_UPDATE":     INTENT_GUILD_PRESENCES,
+	"MESSAGE_CREATE":      INTENT_GUILD_MESSAGES | INTENT_DIRECT_MESSAGES,
+}
+
+// intents returns the gateway intents needed for the events with handlers
+func (d *dispatcher) intents() int {
+	d.RLock()
+	defer d.RUnlock()
+	intents := 0
+	for name := range d.handlers {
+		intents |= eventIntents[name]
+	}
+	return intents
+}
+
+// privilegedIntents are the intents which has to be enabled in the developer
+// portal, see https://discord.com/developers/docs/topics/gateway#privileged-intents
+var privilegedIntents = []struct {
+	intent  int
+	name    string // as shown in the developer portal
+	feature string
+}{
+	{INTENT_GUILD_MEMBERS, "Server Members Intent", "members"},
+	{INTENT_GUILD_PRESENCES, "Presence Intent", "presences"},
+	{INTENT_MESSAGE_CONTENT, "Message Content Intent", "message-content"},
+}
+
+// explainDisallowedIntents describes how to fix a connection closed because of
+// disallowed intents
+func explainDisallowedIntents(intents int) string {
+	var names, features []string
+	for _, privileged := range privilegedIntents {
+		if intents&privileged.intent != 0 {
+			names = append(names, privileged.name)
+			features = append(features, privileged.feature)
+		}
+	}
+	if len(names) == 0 {
+		return fmt.Sprintf("Discord refused the gateway intents %d, none of which are privileged. This is likely a bug in discraft.", intents)
+	}
+	return fmt.Sprintf(
+		"Discord refused the privileged gateway intents. Enable %s under Bot > Privileged Gateway Intents in the developer portal (https://discord.com/developers/applications), or remove %s from DISCRAFT_FEATURES.",
+		strings.Join(names, " and "), strings.Join(features, ", "),
+	)
+}
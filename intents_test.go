@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// privilegedMask are the intents that need to be enabled in the developer portal
+const privilegedMask = INTENT_GUILD_MEMBERS | INTENT_GUILD_PRESENCES | INTENT_MESSAGE_CONTENT
+
+func TestIntents(t *testing.T) {
+	tests := []struct {
+		features string
+		want     int // the privileged intents requested
+	}{
+		{"", 0},
+		{"members", INTENT_GUILD_MEMBERS},
+		{"presences", INTENT_GUILD_PRESENCES},
+		{"message-content", INTENT_MESSAGE_CONTENT},
+		{"members, message-content", INTENT_GUILD_MEMBERS | INTENT_MESSAGE_CONTENT},
+	}
+	for _, test := range tests {
+		f, err := parseFeatures(test.features)
+		if err != nil {
+			t.Errorf("parseFeatures(%q) failed: %+v", test.features, err)
+			continue
+		}
+		// The events subscribed to by discordMain and the cache
+		d := newDispatcher()
+		newGuildCache().subscribe(d, f.members)
+		onDispatch(d, "READY", func(*dispatchReady) {})
+		onDispatch(d, "MESSAGE_CREATE", func(*dispatchMessageCreate) {})
+		intents := d.intents() | f.intents()
+
+		if privileged := intents & privilegedMask; privileged != test.want {
+			t.Errorf("%q: privileged intents = %b, want %b", test.features, privileged, test.want)
+		}
+		want := INTENT_GUILDS | INTENT_GUILD_MESSAGES | INTENT_DIRECT_MESSAGES
+		if intents&want != want {
+			t.Errorf("%q: intents = %b, want at least %b", test.features, intents, want)
+		}
+	}
+
+	if _, err := parseFeatures("members,typo"); err == nil {
+		t.Error("parseFeatures accepted an unknown feature")
+	}
+}
+
+func TestExplainDisallowedIntents(t *testing.T) {
+	if msg := explainDisallowedIntents(INTENT_GUILDS | INTENT_GUILD_MEMBERS); !strings.Contains(msg, "Enable Server Members Intent under") {
+		t.Errorf("explanation does not name the privileged intent: %s", msg)
+	}
+	if msg := explainDisallowedIntents(INTENT_GUILDS); strings.Contains(msg, "Enable  ") {
+		t.Errorf("explanation without privileged intents: %s", msg)
+	}
+}
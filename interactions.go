@@ -0,0 +1,296 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// command is an application command and what to do when it is used
+type command struct {
+	definition   applicationCommandObj
+	run          func(i *interactionObj) interactionResponseObj
+	autocomplete func(i *interactionObj, focused *interactionOptionObj) []string // nil if no option autocompletes
+}
+
+// interactionHandler answers interactions, whether they arrive through the
+// gateway or some other way
+type interactionHandler struct {
+	restClient *restClient
+	mcServer   *mcServer
+	commands   map[string]command
+	components map[string]componentHandler // the part of the custom_id before ":" to handler
+	modals     map[string]func(i *interactionObj) interactionResponseObj
+	registerMu sync.Mutex // held while registering the commands
+	registered bool       // whether the commands have been registered since startup
+}
+
+// componentHandler handles the use of a component, arg is the part of the
+// custom_id after ":"
+type componentHandler func(i *interactionObj, arg string) interactionResponseObj
+
+func newInteractionHandler(restClient *restClient, mcServer *mcServer) *interactionHandler {
+	h := &interactionHandler{
+		restClient: restClient,
+		mcServer:   mcServer,
+		commands:   map[string]command{},
+		components: map[string]componentHandler{},
+		modals:     map[string]func(i *interactionObj) interactionResponseObj{},
+	}
+	h.addCommand(command{
+		definition: applicationCommandObj{
+			Name:        "ping",
+			Description: "Check that discraft is alive",
+		},
+		run: func(i *interactionObj) interactionResponseObj {
+			return messageResponse(messageCreateParams{Content: "pong"})
+		},
+	})
+	h.addCommand(command{
+		definition: applicationCommandObj{
+			Name:        "playing",
+			Description: "List the players on the minecraft server",
+		},
+		run: func(i *interactionObj) interactionResponseObj {
+			return messageResponse(h.view("playing"))
+		},
+	})
+	h.addCommand(command{
+		definition: applicationCommandObj{
+			Name:        "status",
+			Description: "Show the status of the minecraft server",
+		},
+		run: func(i *interactionObj) interactionResponseObj {
+			return messageResponse(h.view("status"))
+		},
+	})
+	h.addCommand(command{
+		definition: applicationCommandObj{
+			Name:        "seen",
+			Description: "Show when a player was last on the minecraft server",
+			Options: []applicationCommandOptionObj{{
+				Type:         OPTION_TYPE_STRING,
+				Name:         "player",
+				Description:  "The name of the player",
+				Required:     true,
+				Autocomplete: true,
+			}},
+		},
+		run:          h.seen,
+		autocomplete: h.completePlayer,
+	})
+	h.components["refresh"] = func(i *interactionObj, view string) interactionResponseObj {
+		return updateResponse(h.view(view))
+	}
+	h.components["view"] = func(i *interactionObj, arg string) interactionResponseObj {
+		if len(i.Data.Values) != 1 {
+			return ephemeralResponse("Pick one view")
+		}
+		return updateResponse(h.view(i.Data.Values[0]))
+	}
+	return h
+}
+
+// seen answers when a player was last online
+func (h *interactionHandler) seen(i *interactionObj) interactionResponseObj {
+	option := i.Data.option("player")
+	if option == nil {
+		return ephemeralResponse("Which player?")
+	}
+	player := option.stringValue()
+	for _, online := range h.mcServer.getPlayers() {
+		if strings.EqualFold(online, player) {
+			return messageResponse(messageCreateParams{Content: fmt.Sprintf("%s is playing right now", escapeMarkdown(online))})
+		}
+	}
+	name, lastSeen, ok := h.mcServer.history.get(player)
+	if !ok {
+		return messageResponse(messageCreateParams{Content: fmt.Sprintf("I have never seen %s", escapeMarkdown(player))})
+	}
+	return messageResponse(messageCreateParams{Content: fmt.Sprintf("%s was last seen <t:%d:R>", escapeMarkdown(name), lastSeen.Unix())})
+}
+
+// completePlayer suggests player names for the focused option
+func (h *interactionHandler) completePlayer(i *interactionObj, focused *interactionOptionObj) []string {
+	return h.mcServer.history.suggest(focused.stringValue(), h.mcServer.getPlayers())
+}
+
+// view renders one of the cardViews with controls
+func (h *interactionHandler) view(view string) messageCreateParams {
+	data := h.mcServer.presenceData()
+	switch view {
+	case "playing":
+		return withControls(playingCard(data.Players, data.Max), view)
+	default:
+		return withControls(statusCard(data), "status")
+	}
+}
+
+func (h *interactionHandler) addCommand(c command) {
+	h.commands[c.definition.Name] = c
+}
+
+// register replaces the global commands of the application with ours
+func (h *interactionHandler) register(application snowflake) error {
+	definitions := []applicationCommandObj{}
+	for _, command := range h.commands {
+		definitions = append(definitions, command.definition)
+	}
+	sort.Slice(definitions, func(a, b int) bool {
+		return definitions[a].Name < definitions[b].Name
+	})
+	registered, err := h.restClient.bulkOverwriteGlobalCommands(application, definitions)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Registered %d application commands\n", len(registered))
+	return nil
+}
+
+// subscribe registers the commands once the gateway is ready and answers the
+// interactions it receives. Both happen in their own goroutines, as blocking
+// the dispatches would also keep the gateway from reading heartbeat ACKs.
+func (h *interactionHandler) subscribe(d *dispatcher) {
+	onDispatch(d, "READY", func(ready *dispatchReady) {
+		go func() {
+			h.registerMu.Lock()
+			defer h.registerMu.Unlock()
+			if h.registered {
+				return
+			}
+			if err := h.register(ready.Application.ID); err != nil {
+				fmt.Printf("Failed to register application commands: %+v\n", err)
+				return
+			}
+			h.registered = true
+		}()
+	})
+	onDispatch(d, "INTERACTION_CREATE", func(event *dispatchInteractionCreate) {
+		i := (*interactionObj)(event)
+		fmt.Printf("Recieve Dispatch: INTERACTION_CREATE: type %d from %+v\n", i.Type, i.user())
+		go func() {
+			response := h.handle(i)
+			if err := h.restClient.createInteractionResponse(i.ID, i.Token, response); err != nil {
+				fmt.Printf("Failed to respond to interaction: %+v\n", err)
+				return
+			}
+			if response.after != nil {
+				response.after()
+			}
+		}()
+	})
+}
+
+// handle returns the response to an interaction
+func (h *interactionHandler) handle(i *interactionObj) interactionResponseObj {
+	switch i.Type {
+	case INTERACTION_TYPE_PING:
+		return interactionResponseObj{Type: INTERACTION_CALLBACK_PONG}
+	case INTERACTION_TYPE_APPLICATION_COMMAND:
+		if i.Data == nil {
+			break
+		}
+		if command, ok := h.commands[i.Data.Name]; ok {
+			return command.run(i)
+		}
+		fmt.Printf("Unknown application command %q\n", i.Data.Name)
+	case INTERACTION_TYPE_MESSAGE_COMPONENT:
+		if i.Data == nil {
+			break
+		}
+		name, arg, _ := strings.Cut(i.Data.CustomID, ":")
+		if handler, ok := h.components[name]; ok {
+			return handler(i, arg)
+		}
+		fmt.Printf("Unknown component %q\n", i.Data.CustomID)
+	case INTERACTION_TYPE_MODAL_SUBMIT:
+		if i.Data == nil {
+			break
+		}
+		if handler, ok := h.modals[i.Data.CustomID]; ok {
+			return handler(i)
+		}
+		fmt.Printf("Unknown modal %q\n", i.Data.CustomID)
+	case INTERACTION_TYPE_APPLICATION_COMMAND_AUTOCOMPLETE:
+		choices := []commandChoiceObj{}
+		if i.Data != nil {
+			command := h.commands[i.Data.Name]
+			if focused := i.Data.focused(); focused != nil && command.autocomplete != nil {
+				for _, suggestion := range command.autocomplete(i, focused) {
+					choices = append(choices, commandChoiceObj{Name: suggestion, Value: suggestion})
+				}
+			}
+		}
+		return interactionResponseObj{
+			Type: INTERACTION_CALLBACK_APPLICATION_COMMAND_AUTOCOMPLETE_RESULT,
+			Data: &interactionCallbackDataObj{Choices: choices},
+		}
+	default:
+		fmt.Printf("Unsupported interaction type %d\n", i.Type)
+	}
+	return ephemeralResponse("Sorry, I don't know how to do that")
+}
+
+// messageResponse responds to an interaction with a message
+func messageResponse(msg messageCreateParams) interactionResponseObj {
+	if msg.AllowedMentions == nil {
+		msg.AllowedMentions = noMentions()
+	}
+	return interactionResponseObj{
+		Type: INTERACTION_CALLBACK_CHANNEL_MESSAGE_WITH_SOURCE,
+		Data: &interactionCallbackDataObj{
+			Content:         msg.Content,
+			Embeds:          msg.Embeds,
+			AllowedMentions: msg.AllowedMentions,
+			Components:      msg.Components,
+		},
+	}
+}
+
+// updateResponse responds to a component interaction by editing the message
+// the component is attached to
+func updateResponse(msg messageCreateParams) interactionResponseObj {
+	response := messageResponse(msg)
+	response.Type = INTERACTION_CALLBACK_UPDATE_MESSAGE
+	return response
+}
+
+// deferredResponse acknowledges an interaction, the message is sent later by
+// after with editOriginalInteractionResponse. Components leave their message
+// as is until then, other interactions show a loading message.
+func deferredResponse(i *interactionObj, ephemeral bool, after func()) interactionResponseObj {
+	response := interactionResponseObj{
+		Type:  INTERACTION_CALLBACK_DEFERRED_CHANNEL_MESSAGE_WITH_SOURCE,
+		after: after,
+	}
+	if i.Type == INTERACTION_TYPE_MESSAGE_COMPONENT {
+		response.Type = INTERACTION_CALLBACK_DEFERRED_UPDATE_MESSAGE
+	} else if ephemeral {
+		response.Data = &interactionCallbackDataObj{Flags: MESSAGE_FLAG_EPHEMERAL}
+	}
+	return response
+}
+
+// editResponse replaces the message of the response to i with msg
+func editResponse(rc *restClient, i *interactionObj, msg messageCreateParams) {
+	if msg.AllowedMentions == nil {
+		msg.AllowedMentions = noMentions()
+	}
+	err := rc.editOriginalInteractionResponse(i.ApplicationID, i.Token, webhookEditMessageParams{
+		Content:         msg.Content,
+		Embeds:          msg.Embeds,
+		AllowedMentions: msg.AllowedMentions,
+		Components:      msg.Components,
+	})
+	if err != nil {
+		fmt.Printf("Failed to edit interaction response: %+v\n", err)
+	}
+}
+
+// ephemeralResponse responds with a message only the user can see
+func ephemeralResponse(content string) interactionResponseObj {
+	response := messageResponse(messageCreateParams{Content: content})
+	response.Data.Flags = MESSAGE_FLAG_EPHEMERAL
+	return response
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// maxInteractionSize limits the size of the interactions we accept
+const maxInteractionSize = 1 << 20
+
+// parsePublicKey parses the hex encoded public key of the application, see
+// https://discord.com/developers/docs/interactions/receiving-and-responding#security-and-authorization
+func parsePublicKey(key string) (ed25519.PublicKey, error) {
+	b, err := hex.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("decoding public key: %w", err)
+	}
+	if len(b) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("public key is %d bytes, expected %d", len(b), ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(b), nil
+}
+
+// verifyInteraction checks that discord signed the body with the key of the
+// application
+func verifyInteraction(publicKey ed25519.PublicKey, header http.Header, body []byte) bool {
+	signature, err := hex.DecodeString(header.Get("X-Signature-Ed25519"))
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return false
+	}
+	timestamp := header.Get("X-Signature-Timestamp")
+	if timestamp == "" {
+		return false
+	}
+	message := append([]byte(timestamp), body...)
+	return ed25519.Verify(publicKey, message, signature)
+}
+
+// interactionServer receives interactions over HTTP instead of the gateway
+// https://discord.com/developers/docs/interactions/receiving-and-responding#receiving-an-interaction
+type interactionServer struct {
+	publicKey ed25519.PublicKey
+	handler   *interactionHandler
+}
+
+func (s *interactionServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxInteractionSize))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+	// Discord sends requests with bad signatures to check that we verify them
+	if !verifyInteraction(s.publicKey, r.Header, body) {
+		http.Error(w, "invalid request signature", http.StatusUnauthorized)
+		return
+	}
+
+	interaction := &interactionObj{}
+	if err := json.Unmarshal(body, interaction); err != nil {
+		http.Error(w, "invalid interaction", http.StatusBadRequest)
+		return
+	}
+	if interaction.Type != INTERACTION_TYPE_PING {
+		fmt.Printf("Recieve HTTP interaction: type %d from %+v\n", interaction.Type, interaction.user())
+	}
+
+	response := s.handler.handle(interaction)
+	body, err = json.Marshal(response)
+	if err != nil {
+		fmt.Printf("Failed to marshal interaction response: %+v\n", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(body); err != nil {
+		fmt.Printf("Failed to write interaction response: %+v\n", err)
+		return
+	}
+	if response.after != nil {
+		// The response has to reach discord before the deferred work edits it
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		go response.after()
+	}
+}
+
+// serveInteractions runs the interactions endpoint on addr until it fails
+func serveInteractions(addr string, publicKey ed25519.PublicKey, handler *interactionHandler) error {
+	fmt.Printf("Serving interactions on %s\n", addr)
+	return http.ListenAndServe(addr, &interactionServer{
+		publicKey: publicKey,
+		handler:   handler,
+	})
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func signedRequest(t *testing.T, key ed25519.PrivateKey, body string) *http.Request {
+	t.Helper()
+	timestamp := "1700000000"
+	req := httptest.NewRequest("POST", "/", bytes.NewBufferString(body))
+	req.Header.Set("X-Signature-Timestamp", timestamp)
+	req.Header.Set("X-Signature-Ed25519", hex.EncodeToString(ed25519.Sign(key, []byte(timestamp+body))))
+	return req
+}
+
+func TestInteractionServer(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := parsePublicKey(hex.EncodeToString(publicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := newInteractionHandler(nil, &mcServer{players: map[string]struct{}{}})
+	server := &interactionServer{publicKey: parsed, handler: handler}
+
+	respond := func(req *http.Request) (int, interactionResponseObj) {
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		res := rec.Result()
+		body, _ := io.ReadAll(res.Body)
+		response := interactionResponseObj{}
+		if res.StatusCode == http.StatusOK {
+			if err := json.Unmarshal(body, &response); err != nil {
+				t.Fatalf("parsing response %q: %+v", body, err)
+			}
+		}
+		return res.StatusCode, response
+	}
+
+	// Recorded from discord, with the ids shortened
+	ping := `{"application_id":"1","id":"2","token":"tok","type":1,"user":{"id":"3","username":"someone"},"version":1}`
+	status, response := respond(signedRequest(t, privateKey, ping))
+	if status != http.StatusOK || response.Type != INTERACTION_CALLBACK_PONG {
+		t.Errorf("PING got %d %+v, want a PONG", status, response)
+	}
+
+	command := `{"application_id":"1","channel_id":"4","data":{"id":"5","name":"ping","type":1},"guild_id":"6","id":"7","member":{"user":{"id":"3","username":"someone"},"roles":[]},"token":"tok","type":2,"version":1}`
+	status, response = respond(signedRequest(t, privateKey, command))
+	if status != http.StatusOK || response.Type != INTERACTION_CALLBACK_CHANNEL_MESSAGE_WITH_SOURCE || response.Data.Content != "pong" {
+		t.Errorf("/ping got %d %+v, want pong", status, response)
+	}
+
+	refresh := `{"application_id":"1","channel_id":"4","data":{"component_type":2,"custom_id":"refresh:playing"},"id":"8","message":{"id":"9","channel_id":"4"},"token":"tok","type":3,"version":1}`
+	status, response = respond(signedRequest(t, privateKey, refresh))
+	if status != http.StatusOK || response.Type != INTERACTION_CALLBACK_UPDATE_MESSAGE || len(response.Data.Components) == 0 {
+		t.Errorf("refresh got %d %+v, want the message updated with its controls", status, response)
+	}
+
+	tampered := signedRequest(t, privateKey, ping)
+	tampered.Body = io.NopCloser(bytes.NewBufferString(command))
+	if status, _ := respond(tampered); status != http.StatusUnauthorized {
+		t.Errorf("tampered body got %d, want 401", status)
+	}
+
+	_, otherKey, _ := ed25519.GenerateKey(nil)
+	if status, _ := respond(signedRequest(t, otherKey, ping)); status != http.StatusUnauthorized {
+		t.Errorf("wrong key got %d, want 401", status)
+	}
+
+	unsigned := httptest.NewRequest("POST", "/", bytes.NewBufferString(ping))
+	if status, _ := respond(unsigned); status != http.StatusUnauthorized {
+		t.Errorf("unsigned request got %d, want 401", status)
+	}
+}
@@ -2,9 +2,11 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/ed25519"
+	"errors"
 	"fmt"
 	"os"
+	"reflect"
 	"sort"
 	"strconv"
 	"strings"
@@ -15,8 +17,12 @@ import (
 const discordBaseURL = "https://discord.com/api"
 
 const (
+	INTENT_GUILDS          = 1 << 0
+	INTENT_GUILD_MEMBERS   = 1 << 1 // privileged
+	INTENT_GUILD_PRESENCES = 1 << 8 // privileged
 	INTENT_GUILD_MESSAGES  = 1 << 9
 	INTENT_DIRECT_MESSAGES = 1 << 12
+	INTENT_MESSAGE_CONTENT = 1 << 15 // privileged
 )
 
 func main() {
@@ -30,34 +36,111 @@ func main() {
 	for _, env := range reqEnvs {
 		if os.Getenv(env) == "" {
 			fmt.Printf("Please set these environment variables: %s\n", strings.Join(reqEnvs, ", "))
-			fmt.Printf("%s is not set\n", env)
-			os.Exit(10) // exit-status 10 means the service will not restart
+			exitNoRestart("%s is not set", env)
 		}
 	}
 
+	features, err := parseFeatures(os.Getenv("DISCRAFT_FEATURES"))
+	if err != nil {
+		exitNoRestart("DISCRAFT_FEATURES is invalid: %+v", err)
+	}
+
+	shardCount, err := parseShardCount(os.Getenv("DISCRAFT_SHARDS"))
+	if err != nil {
+		exitNoRestart("DISCRAFT_SHARDS is invalid: %+v", err)
+	}
+
+	interactionsAddr := os.Getenv("DISCRAFT_INTERACTIONS_ADDR")
+	var publicKey ed25519.PublicKey
+	if interactionsAddr != "" {
+		publicKey, err = parsePublicKey(os.Getenv("DISCRAFT_PUBLIC_KEY"))
+		if err != nil {
+			exitNoRestart("DISCRAFT_PUBLIC_KEY is invalid: %+v", err)
+		}
+	}
+	useGateway := !envBool("DISCRAFT_DISABLE_GATEWAY")
+	if !useGateway && interactionsAddr == "" {
+		exitNoRestart("DISCRAFT_DISABLE_GATEWAY needs DISCRAFT_INTERACTIONS_ADDR, or discraft cannot receive commands")
+	}
+
 	restClient := newRESTClient()
 
-	gatewayURL, err := restClient.getGatewayURL()
+	// Without the gateway messages are sent through REST only, and there is
+	// no presence
+	var gw *shardGroup
+	if useGateway {
+		gw = newShardGroup(restClient, os.Getenv("DISCRAFT_TOKEN"), envBool("DISCRAFT_COMPRESS"), shardCount)
+		defer gw.Close()
+	}
+
+	presenceConfig, err := parsePresenceConfig(os.Getenv("DISCRAFT_PRESENCE"), os.Getenv("DISCRAFT_PRESENCE_INTERVAL"))
 	if err != nil {
-		panic(err)
+		exitNoRestart("DISCRAFT_PRESENCE is invalid: %+v", err)
+	}
+
+	linked, err := parseLinkedUsers(os.Getenv("DISCRAFT_LINKED_USERS"))
+	if err != nil {
+		exitNoRestart("DISCRAFT_LINKED_USERS is invalid: %+v", err)
 	}
 
-	fmt.Printf("Connecting to Gateway URL = %+v\n", gatewayURL)
+	var webhook *webhookRelay
+	if envBool("DISCRAFT_WEBHOOK") {
+		webhook, err = newWebhookRelay(restClient, snowflake(os.Getenv("DISCRAFT_CHANNEL")), os.Getenv("DISCRAFT_AVATAR_URL"))
+		if err != nil {
+			exitNoRestart("DISCRAFT_AVATAR_URL is invalid: %+v", err)
+		}
+	}
 
-	gw, err := newGateway(gatewayURL)
+	history, err := loadPlayerHistory(stateDir())
 	if err != nil {
-		panic(err)
+		exitNoRestart("Failed to load the state of discraft: %+v", err)
 	}
-	defer gw.Close()
 
-	mcServer := newMCServer(gw, restClient)
+	mcServer := newMCServer(gw, restClient, presenceConfig, linked, webhook, history)
+
+	dispatcher := newDispatcher()
+	cache := newGuildCache()
+	cache.subscribe(dispatcher, features.members)
+	interactions := newInteractionHandler(restClient, mcServer)
+	if adminChannel := os.Getenv("DISCRAFT_ADMIN_CHANNEL"); adminChannel != "" {
+		var rcon *rconClient
+		if addr := os.Getenv("DISCRAFT_RCON_ADDR"); addr != "" {
+			rcon = &rconClient{addr: addr, password: os.Getenv("DISCRAFT_RCON_PASSWORD")}
+		}
+		applications, err := loadApplicationWorkflow(stateDir(), restClient, snowflake(adminChannel), rcon)
+		if err != nil {
+			exitNoRestart("Failed to load the state of discraft: %+v", err)
+		}
+		applications.register(interactions)
+	}
+	interactions.subscribe(dispatcher)
 
 	var wg sync.WaitGroup
-	wg.Add(2)
-	go func() {
-		discordMain(gw, restClient, mcServer)
-		wg.Done()
-	}()
+	if useGateway {
+		wg.Add(1)
+		go func() {
+			discordMain(gw, dispatcher, cache, restClient, mcServer, features)
+			wg.Done()
+		}()
+	} else {
+		go func() {
+			application, err := restClient.getCurrentApplication()
+			if err == nil {
+				err = interactions.register(application.ID)
+			}
+			if err != nil {
+				fmt.Printf("Failed to register application commands: %+v\n", err)
+			}
+		}()
+	}
+	if interactionsAddr != "" {
+		go func() {
+			err := serveInteractions(interactionsAddr, publicKey, interactions)
+			fmt.Printf("Interactions server stopped: %+v\n", err)
+			os.Exit(1)
+		}()
+	}
+	wg.Add(1)
 	go func() {
 		mcServer.run(context.Background())
 		wg.Done()
@@ -66,97 +149,99 @@ func main() {
 	wg.Wait()
 }
 
-func discordMain(gw *gateway, restClient *restClient, mcServer *mcServer) {
-	var initialStartup sync.Once
+// stateDir returns the directory discraft keeps its state in, empty if the
+// state is not saved. systemd sets STATE_DIRECTORY from StateDirectory=.
+func stateDir() string {
+	if dir := os.Getenv("DISCRAFT_STATE_DIR"); dir != "" {
+		return dir
+	}
+	dir, _, _ := strings.Cut(os.Getenv("STATE_DIRECTORY"), ":")
+	return dir
+}
+
+// exitNoRestart prints why discraft can not run and exits with status 10,
+// which the service unit does not restart as restarting will not help
+func exitNoRestart(format string, args ...any) {
+	fmt.Printf(format+"\n", args...)
+	os.Exit(10)
+}
+
+// envBool parses an optional boolean environment variable, unset means false
+func envBool(name string) bool {
+	value := os.Getenv(name)
+	if value == "" {
+		return false
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		exitNoRestart("%s must be a boolean, got %q", name, value)
+	}
+	return b
+}
+
+func discordMain(gw *shardGroup, dispatcher *dispatcher, cache *guildCache, restClient *restClient, mcServer *mcServer, features features) {
 	var myID snowflake
+	var myUserID snowflake
+	pendingGuilds := map[snowflake]struct{}{} // guilds from READY not yet created
 
-	for {
-		message, err := gw.ReadMessage()
-		if err != nil {
-			panic(err)
+	onDispatch(dispatcher, "READY", func(d *dispatchReady) {
+		myID = d.Application.ID
+		myUserID = d.User.ID
+		fmt.Printf("Recieve: Ready: %+v\n", d)
+		fmt.Printf("myID = %+v\n", myID)
+		for _, guild := range d.Guilds {
+			if !cache.hasGuild(guild.ID) {
+				pendingGuilds[guild.ID] = struct{}{}
+			}
 		}
-		payload := &wsPayload{}
-		if err := json.Unmarshal(message, payload); err != nil {
-			fmt.Printf("Failed to parse message (follows); err is %+v\n\t%s\n", payload, message)
-			continue
+	})
+	onDispatch(dispatcher, "GUILD_CREATE", func(d *dispatchGuildCreate) {
+		fmt.Printf("Recieve Dispatch: GUILD_CREATE: %s (%s)\n", d.Name, d.ID)
+		delete(pendingGuilds, d.ID)
+		if channel, ok := cache.channel(mcServer.channelID); ok {
+			if channel.GuildID == nil || *channel.GuildID != d.ID {
+				return
+			}
+			if err := cache.checkChannel(mcServer.channelID, myUserID); err != nil {
+				fmt.Printf("DISCRAFT_CHANNEL is not usable: %+v\n", err)
+			}
+		} else if len(pendingGuilds) == 0 {
+			fmt.Printf("DISCRAFT_CHANNEL %s was not found in any guild\n", mcServer.channelID)
 		}
-
-		switch d := payload.D.(type) {
-		case *opHello:
-			heartbeatInterval := d.HeartbeatInterval
-			fmt.Printf("Recieve: Hello Payload with HeartbeatInterval %v\n", heartbeatInterval)
-			initialStartup.Do(func() {
-				go func() {
-					for {
-						time.Sleep(heartbeatInterval)
-						if err := gw.writeJSONMessage(wsPayload{
-							OP: 1,
-						}); err != nil {
-							panic(err)
-						}
-					}
-				}()
-				if err := gw.writeJSONMessage(wsPayload{
-					OP: 2,
-					D: opIdentify{
-						Token: os.Getenv("DISCRAFT_TOKEN"),
-						Properties: identifyProperties{
-							OS:      "linux",
-							Browser: "discraft",
-							Device:  "discraft",
-						},
-						Intents: INTENT_GUILD_MESSAGES | INTENT_DIRECT_MESSAGES,
-					},
-				}); err != nil {
-					panic(err)
-				}
-			})
-		case *opHeartbeatACK:
-			fmt.Println("Recieve: Heartbeat ACK")
-		case *opReconnect:
-			fmt.Println("Recieve: Reconnect")
-			fmt.Println("Shutting down..")
-			os.Exit(0)
-		case *dispatchReady:
-			myID = d.Application.ID
-			fmt.Printf("Recieve: Ready: %+v\n", d)
-			fmt.Printf("myID = %+v\n", myID)
-		case *dispatchMessageCreate:
-			fmt.Printf("Recieve Dispatch: MESSAGE_CREATE = <%s> %s\n", d.Author.Username, d.Content)
-			mentionsMe := false
-			for _, mention := range d.Mentions {
-				if mention.ID == myID {
-					mentionsMe = true
-					break
-				}
+	})
+	onDispatch(dispatcher, "MESSAGE_CREATE", func(d *dispatchMessageCreate) {
+		fmt.Printf("Recieve Dispatch: MESSAGE_CREATE = <%s> %s\n", d.Author.Username, d.Content)
+		mentionsMe := false
+		for _, mention := range d.Mentions {
+			if mention.ID == myID {
+				mentionsMe = true
+				break
 			}
-			if mentionsMe {
-				striped := d.Content
-				striped = strings.ReplaceAll(striped, fmt.Sprintf("<@!%s>", myID), "")
-				striped = strings.ReplaceAll(striped, fmt.Sprintf("<@&%s>", myID), "")
-				striped = strings.ReplaceAll(striped, fmt.Sprintf("<@%s>", myID), "")
-				striped = strings.TrimSpace(striped)
+		}
+		if mentionsMe {
+			striped := d.Content
+			striped = strings.ReplaceAll(striped, fmt.Sprintf("<@!%s>", myID), "")
+			striped = strings.ReplaceAll(striped, fmt.Sprintf("<@&%s>", myID), "")
+			striped = strings.ReplaceAll(striped, fmt.Sprintf("<@%s>", myID), "")
+			striped = strings.TrimSpace(striped)
+			// The replies can wait for rate limits and retries, which must not
+			// keep the gateway from reading
+			go func() {
 				switch strings.ToLower(striped) {
 				case "ping":
-					msg, err := restClient.createMessage(d.ChannelID, "pong")
+					msg, err := restClient.createMessage(d.ChannelID, messageCreateParams{Content: "pong"})
 					if err != nil {
-						fmt.Printf("Failed to create message: %+v", err)
+						fmt.Printf("Failed to create message: %+v\n", err)
 						break
 					}
 					fmt.Printf("msg = %+v\n", msg)
 				case "playing?":
-					players := mcServer.getPlayers()
-					var reply string
-					if len(players) == 0 {
-						reply = "No one is playing :("
-					} else if len(players) == 1 {
-						reply = fmt.Sprintf("Currently %s is playing alone", players[0])
-					} else {
-						reply = fmt.Sprintf("Currently %s and %s are playing", strings.Join(players[1:], ", "), players[0])
-					}
-					msg, err := restClient.createMessage(d.ChannelID, reply)
+					mcServer.Lock()
+					maxPlayers := mcServer.maxPlayers
+					mcServer.Unlock()
+					msg, err := restClient.createMessage(d.ChannelID, withControls(playingCard(mcServer.getPlayers(), maxPlayers), "playing"))
 					if err != nil {
-						fmt.Printf("Failed to respond to playing: %+v", err)
+						fmt.Printf("Failed to respond to playing: %+v\n", err)
 						return
 					}
 					fmt.Printf("msg = %+v\n", msg)
@@ -164,22 +249,53 @@ func discordMain(gw *gateway, restClient *restClient, mcServer *mcServer) {
 					fmt.Println("This message was for me but I didn't know what to do")
 					fmt.Printf("The stripped content was '%s'\n", striped)
 				}
-			}
-		case *dispatchChannelCreate:
-			fmt.Printf("Recieve Dispatch: CHANNEL_CREATE: %+v\n", d)
-		default:
-			fmt.Printf("Recieve: Unsupported payload: %+v\nD: %+v\n", payload, payload.D)
+			}()
 		}
+	})
+	onDispatch(dispatcher, "CHANNEL_CREATE", func(d *dispatchChannelCreate) {
+		fmt.Printf("Recieve Dispatch: CHANNEL_CREATE: %+v\n", d)
+	})
+
+	// Only ask for the events something is subscribed to, and for the
+	// privileged intents of the features enabled in DISCRAFT_FEATURES
+	if err := gw.run(context.Background(), dispatcher.intents()|features.intents(), dispatcher.dispatch); err != nil {
+		exitNoRestart("%v", err)
 	}
 }
 
+// maxPendingMessages limits how many messages are buffered while the gateway
+// is disconnected
+const maxPendingMessages = 100
+
+// pendingMessage is a message buffered while the gateway is disconnected,
+// either chat of a player or a message from the bot
+type pendingMessage struct {
+	chat *logMsg
+	msg  messageCreateParams
+}
+
 type mcServer struct {
 	sync.Mutex
-	players      map[string]struct{}
-	latestStatus string
+	players    map[string]struct{}
+	maxPlayers int
+	motd       string
+	pinged     bool      // whether the server has been pinged yet
+	online     bool      // whether the last ping succeeded
+	upSince    time.Time // when the server started answering pings
+
+	presenceConfig presenceConfig
+	rotation       int               // the presence template currently shown
+	latestPresence *opUpdatePresence // the presence last sent to discord
+
+	pending       []pendingMessage  // messages waiting for the gateway to connect
+	announceJoins bool              // whether joins and parts are sent to the channel
+	render        chatRenderer      // turns minecraft chat into discord messages
+	webhook       *webhookRelay     // sends chat as the players, nil to send it as the bot
+	uuids         map[string]string // player names to UUIDs, from the log
+	history       *playerHistory    // when players were last seen
 
 	restClient *restClient
-	gw         *gateway
+	gw         *shardGroup
 	channelID  snowflake
 }
 
@@ -215,47 +331,180 @@ func (serv *mcServer) getPlayers() []string {
 	return players
 }
 
-func newMCServer(gw *gateway, restClient *restClient) *mcServer {
+func newMCServer(gw *shardGroup, restClient *restClient, presenceConfig presenceConfig, linked linkedUsers, webhook *webhookRelay, history *playerHistory) *mcServer {
 	mcChannelID := snowflake(os.Getenv("DISCRAFT_CHANNEL"))
 	if len(mcChannelID) == 0 {
 		panic("DISCRAFT_CHANNEL not set")
 	}
 
-	return &mcServer{
-		players:    map[string]struct{}{},
-		channelID:  mcChannelID,
-		restClient: restClient,
-		gw:         gw,
+	serv := &mcServer{
+		players:        map[string]struct{}{},
+		uuids:          map[string]string{},
+		webhook:        webhook,
+		history:        history,
+		presenceConfig: presenceConfig,
+		channelID:      mcChannelID,
+		restClient:     restClient,
+		gw:             gw,
+		announceJoins:  envBool("DISCRAFT_ANNOUNCE_JOINS"),
+		render: chatRenderer{
+			ansi:   envBool("DISCRAFT_ANSI_COLORS"),
+			linked: linked,
+		},
 	}
+	serv.updateStatus() // the initial presence used when identifying
+	return serv
 }
 
-func (serv *mcServer) updateStatus() {
+func (serv *mcServer) setOnline(online bool) {
+	serv.Lock()
+	defer serv.Unlock()
+	if online && !serv.online {
+		serv.upSince = time.Now()
+	}
+	serv.pinged = true
+	serv.online = online
+}
+
+func (serv *mcServer) presenceData() presenceData {
 	players := serv.getPlayers()
-	status := "is none" // will be displayed as "Playing is none"
-	if len(players) > 0 {
-		status = fmt.Sprintf("is %d players", len(players))
+	serv.Lock()
+	defer serv.Unlock()
+	data := presenceData{
+		Online:  serv.online,
+		Players: players,
+		Count:   len(players),
+		Max:     serv.maxPlayers,
+		MOTD:    serv.motd,
+	}
+	if serv.online {
+		data.Uptime = formatUptime(time.Since(serv.upSince))
 	}
+	return data
+}
 
-	serv.setStatus(status)
+// unknownPresence is shown until the first ping, when it is not yet known
+// whether the server is up
+var unknownPresence = opUpdatePresence{
+	Status:     "online",
+	Activities: []activityObject{{Type: activityTypes["playing"], Name: "Minecraft"}},
 }
 
-func (serv *mcServer) setStatus(status string) {
-	if status == serv.latestStatus {
+// presence renders the current presence template
+func (serv *mcServer) presence() opUpdatePresence {
+	serv.Lock()
+	pinged := serv.pinged
+	serv.Unlock()
+	if !pinged {
+		return unknownPresence
+	}
+	data := serv.presenceData()
+	templates := serv.presenceConfig.templates
+	activity, err := templates[serv.rotation%len(templates)].render(data)
+	if err != nil {
+		fmt.Printf("Failed to render presence: %+v\n", err)
+		activity = activityObject{Type: activityTypes["playing"], Name: "Minecraft"}
+	}
+	status := "online"
+	if !data.Online {
+		status = "dnd"
+	}
+	return opUpdatePresence{
+		Status:     status,
+		Activities: []activityObject{activity},
+	}
+}
+
+func (serv *mcServer) updateStatus() {
+	presence := serv.presence()
+	if serv.latestPresence != nil && reflect.DeepEqual(presence, *serv.latestPresence) {
 		return
 	}
-	serv.latestStatus = status
+	if serv.gw == nil {
+		return
+	}
+	if err := serv.gw.updatePresence(presence); err != nil {
+		fmt.Printf("Failed to update presence: %+v\n", err)
+		return
+	}
+	serv.latestPresence = &presence
+}
 
-	if err := serv.gw.writeJSONMessage(wsPayload{
-		OP: 3,
-		D: opUpdatePresence{
-			Since:  int(time.Now().Unix()),
-			Status: "idle",
-			Activities: []activityObject{
-				{Type: 0, Name: status},
-			},
-		},
-	}); err != nil {
-		panic(err)
+// sendMessage sends a message to the minecraft channel, or buffers it if the
+// gateway is disconnected as discord is probably unavailable. Messages ping
+// no one unless they allow mentions.
+func (serv *mcServer) sendMessage(msg messageCreateParams) {
+	if msg.AllowedMentions == nil {
+		msg.AllowedMentions = noMentions()
+	}
+	if serv.buffer(pendingMessage{msg: msg}) {
+		return
+	}
+	_, err := serv.restClient.createMessage(serv.channelID, msg)
+	var apiErr *discordAPIError
+	switch {
+	case err == nil:
+	case isPermissionError(err):
+		fmt.Printf("Not allowed to send messages to DISCRAFT_CHANNEL %s, check the permissions of the bot: %+v\n", serv.channelID, err)
+	case errors.As(err, &apiErr) && apiErr.Code == errorCodeUnknownChannel:
+		fmt.Printf("DISCRAFT_CHANNEL %s does not exist: %+v\n", serv.channelID, err)
+	case isTransientError(err):
+		fmt.Printf("Failed to create message %+v, discord is having trouble: %+v\n", msg, err)
+	default:
+		fmt.Printf("failed to create message %+v: %+v\n", msg, err)
+	}
+}
+
+// sendChat relays a chat message, through the webhook if there is one and
+// otherwise, or if the webhook fails, as the bot
+func (serv *mcServer) sendChat(l logMsg) {
+	if serv.webhook != nil {
+		if serv.buffer(pendingMessage{chat: &l}) {
+			return
+		}
+		player := avatarData{Name: stripFormatting(l.user), UUID: serv.uuids[l.user]}
+		err := serv.webhook.send(player, serv.render.webhookChat(l.msg))
+		if err == nil {
+			return
+		}
+		if !rejectedByWebhook(err) {
+			// Discord may have posted it anyway, sending it again could duplicate it
+			fmt.Printf("Failed to send chat through the webhook: %+v\n", err)
+			return
+		}
+		fmt.Printf("Failed to send chat through the webhook, sending it as the bot: %+v\n", err)
+	}
+	serv.sendMessage(serv.render.chat(l.user, l.msg))
+}
+
+// buffer keeps msg for later if the gateway is disconnected, as discord is
+// probably unavailable, and reports whether it did
+func (serv *mcServer) buffer(msg pendingMessage) bool {
+	if serv.gw == nil || serv.gw.connected() {
+		return false
+	}
+	if len(serv.pending) >= maxPendingMessages {
+		fmt.Printf("Dropping buffered message: %+v\n", serv.pending[0])
+		serv.pending = serv.pending[1:]
+	}
+	serv.pending = append(serv.pending, msg)
+	return true
+}
+
+// reconnected restores the presence and sends everything that was buffered
+// while the gateway was disconnected
+func (serv *mcServer) reconnected() {
+	serv.latestPresence = nil // a resumed session may have lost the presence
+	serv.updateStatus()
+
+	pending := serv.pending
+	serv.pending = nil
+	for _, msg := range pending {
+		if msg.chat != nil {
+			serv.sendChat(*msg.chat)
+		} else {
+			serv.sendMessage(msg.msg)
+		}
 	}
 }
 
@@ -270,29 +519,70 @@ func (serv *mcServer) run(ctx context.Context) {
 		panic(err)
 	}
 
-	for log := range lines {
-		switch l := log.(type) {
-		case logJoin:
-			serv.playerJoined(l.user)
-			serv.updateStatus()
-		case logPart:
-			serv.playerParted(l.user)
+	var rotate <-chan time.Time
+	if len(serv.presenceConfig.templates) > 1 {
+		ticker := time.NewTicker(serv.presenceConfig.interval)
+		defer ticker.Stop()
+		rotate = ticker.C
+	}
+
+	var states <-chan gatewayState
+	if serv.gw != nil {
+		states = serv.gw.subscribe()
+	}
+	for {
+		select {
+		case <-rotate:
+			serv.rotation++
 			serv.updateStatus()
-		case logMsg:
-			if _, err := serv.restClient.createMessage(serv.channelID, fmt.Sprintf("<%s> %s", l.user, l.msg)); err != nil {
-				fmt.Printf("failed to create message for %#v: %+v", l, err)
+		case state := <-states:
+			if state == gatewayConnected {
+				serv.reconnected()
 			}
-		case logCorruption:
-			if _, err := serv.restClient.createMessage(serv.channelID, "Corruption detected in log. Someone probably needs to restore a backup!"); err != nil {
-				fmt.Printf("failed to create message for %#v: %+v", l, err)
+		case log, ok := <-lines:
+			if !ok {
+				return
 			}
-		case mcPing:
-			serv.setPlayers(l.players)
-			serv.updateStatus()
-		case mcError:
-			serv.setStatus("is none because ping failed")
-		default:
-			fmt.Printf("Unsupported mc log of type %T: %+v", l, l)
+			serv.handle(log)
+		}
+	}
+}
+
+func (serv *mcServer) handle(log any) {
+	switch l := log.(type) {
+	case logJoin:
+		serv.playerJoined(l.user)
+		serv.history.seen(time.Now(), true, l.user)
+		serv.updateStatus()
+		if serv.announceJoins {
+			serv.sendMessage(joinCard(l.user))
+		}
+	case logPart:
+		serv.playerParted(l.user)
+		serv.history.seen(time.Now(), true, l.user)
+		serv.updateStatus()
+		if serv.announceJoins {
+			serv.sendMessage(partCard(l.user))
 		}
+	case logMsg:
+		serv.sendChat(l)
+	case logUUID:
+		serv.uuids[l.user] = l.uuid
+	case logCorruption:
+		serv.sendMessage(corruptionCard())
+	case mcPing:
+		serv.setPlayers(l.players)
+		serv.history.seen(time.Now(), false, l.players...)
+		serv.Lock()
+		serv.maxPlayers = l.maxPlayers
+		serv.motd = l.motd
+		serv.Unlock()
+		serv.setOnline(true)
+		serv.updateStatus()
+	case mcError:
+		serv.setOnline(false)
+		serv.updateStatus()
+	default:
+		fmt.Printf("Unsupported mc log of type %T: %+v", l, l)
 	}
 }
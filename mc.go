@@ -6,6 +6,7 @@ import (
 	"io"
 	"regexp"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/alteamc/minequery/ping"
@@ -27,8 +28,15 @@ type logMsg struct {
 
 type logCorruption struct{}
 
+type logUUID struct {
+	user string
+	uuid string
+}
+
 type mcPing struct {
-	players []string
+	players    []string
+	maxPlayers int
+	motd       string
 }
 
 type mcError struct{}
@@ -48,6 +56,7 @@ func parseMCLog(ctx context.Context, out chan any, file string) error {
 	joinRegex := regexp.MustCompile(fmt.Sprintf(`\[%s\] \[Server thread\/INFO\]: (.*) joined the game`, timeRegex))
 	partRegex := regexp.MustCompile(fmt.Sprintf(`\[%s\] \[Server thread\/INFO\]: (.*) left the game`, timeRegex))
 	msgRegex := regexp.MustCompile(fmt.Sprintf(`\[%s\] \[Server thread\/INFO\]: <([^>]+)> (.*)`, timeRegex))
+	uuidRegex := regexp.MustCompile(fmt.Sprintf(`\[%s\] \[User Authenticator #\d+\/INFO\]: UUID of player (.*) is ([0-9a-f-]+)`, timeRegex))
 	corruptionRegex := regexp.MustCompile(fmt.Sprintf(`\[%s\] \[Server thread\/WARN\] \[FML\/]: .*Forge Mod Loader detected that the backup level.dat is being used.`, timeRegex))
 
 	t, err := tail.TailFile(file, tail.Config{
@@ -88,6 +97,12 @@ func parseMCLog(ctx context.Context, out chan any, file string) error {
 					msg:  match[2],
 				}
 			}
+			if match := uuidRegex.FindStringSubmatch(line.Text); len(match) > 0 {
+				out <- logUUID{
+					user: match[1],
+					uuid: match[2],
+				}
+			}
 			if match := corruptionRegex.FindStringSubmatch(line.Text); len(match) > 0 {
 				out <- logCorruption{}
 			}
@@ -98,6 +113,26 @@ func parseMCLog(ctx context.Context, out chan any, file string) error {
 	return nil
 }
 
+var formattingCodeRegex = regexp.MustCompile(`§.`)
+
+// chatText returns the plain text of a chat component, see
+// https://wiki.vg/Chat#Current_system_.28JSON_Chat.29
+func chatText(component any) string {
+	switch c := component.(type) {
+	case string:
+		return formattingCodeRegex.ReplaceAllString(c, "")
+	case []any:
+		var text strings.Builder
+		for _, part := range c {
+			text.WriteString(chatText(part))
+		}
+		return text.String()
+	case map[string]any:
+		return chatText(c["text"]) + chatText(c["extra"])
+	}
+	return ""
+}
+
 func pingMCServer(ctx context.Context, out chan any, host string, port uint16) {
 	pingServer := func() {
 		res, err := ping.Ping(host, port)
@@ -114,7 +149,9 @@ func pingMCServer(ctx context.Context, out chan any, host string, port uint16) {
 		sort.Strings(players)
 
 		out <- mcPing{
-			players: players,
+			players:    players,
+			maxPlayers: res.Players.Max,
+			motd:       chatText(res.Description),
 		}
 	}
 
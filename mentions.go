@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// https://discord.com/developers/docs/resources/channel#allowed-mentions-object
+type allowedMentionsObj struct {
+	Parse       []string    `json:"parse"`                  // an array of allowed mention types to parse from the content
+	Roles       []snowflake `json:"roles,omitempty"`        // array of role_ids to mention (max size of 100)
+	Users       []snowflake `json:"users,omitempty"`        // array of user_ids to mention (max size of 100)
+	RepliedUser bool        `json:"replied_user,omitempty"` // for replies, whether to mention the author of the message being replied to
+}
+
+// noMentions makes discord ignore all mentions in a message
+func noMentions() *allowedMentionsObj {
+	return &allowedMentionsObj{Parse: []string{}}
+}
+
+// linkedUsers maps minecraft player names to the discord users they are
+// allowed to ping from the game
+type linkedUsers map[string]snowflake
+
+// parseLinkedUsers parses a comma separated list of player:userid pairs
+func parseLinkedUsers(list string) (linkedUsers, error) {
+	linked := linkedUsers{}
+	for _, pair := range strings.Split(list, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		player, id, ok := strings.Cut(pair, ":")
+		if !ok || player == "" || !isSnowflake(id) {
+			return nil, fmt.Errorf("%q is not on the form player:userid", pair)
+		}
+		linked[strings.ToLower(player)] = snowflake(id)
+	}
+	return linked, nil
+}
+
+var (
+	playerMentionRegex = regexp.MustCompile(`@(\w{1,16})`)
+	userMentionRegex   = regexp.MustCompile(`<@!?(\d+)>`)
+)
+
+// mentions turns @player of linked players into user mentions, and returns
+// the allowed mentions that only let content ping linked users. Mass and role
+// mentions are never allowed.
+func (linked linkedUsers) mentions(content string) (string, *allowedMentionsObj) {
+	content = playerMentionRegex.ReplaceAllStringFunc(content, func(mention string) string {
+		if id, ok := linked[strings.ToLower(mention[1:])]; ok {
+			return fmt.Sprintf("<@%s>", id)
+		}
+		return mention
+	})
+
+	allowed := map[snowflake]bool{}
+	for _, id := range linked {
+		allowed[id] = true
+	}
+	mentions := noMentions()
+	seen := map[snowflake]bool{}
+	for _, match := range userMentionRegex.FindAllStringSubmatch(content, -1) {
+		id := snowflake(match[1])
+		if allowed[id] && !seen[id] {
+			seen[id] = true
+			mentions.Users = append(mentions.Users, id)
+		}
+	}
+	return content, mentions
+}
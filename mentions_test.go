@@ -0,0 +1,36 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLinkedUserMentions(t *testing.T) {
+	linked, err := parseLinkedUsers("Steve:123, alex:456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		content string
+		want    string
+		users   []snowflake
+	}{
+		{"@everyone look", "@everyone look", nil},
+		{"hi <@&789> and <@999>", "hi <@&789> and <@999>", nil},
+		{"@steve @Alex @steve", "<@123> <@456> <@123>", []snowflake{"123", "456"}},
+		{"ping <@!456>", "ping <@!456>", []snowflake{"456"}},
+	}
+	for _, test := range tests {
+		content, mentions := linked.mentions(test.content)
+		if content != test.want {
+			t.Errorf("mentions(%q) content = %q, want %q", test.content, content, test.want)
+		}
+		if len(mentions.Parse) != 0 || len(mentions.Roles) != 0 || !reflect.DeepEqual(mentions.Users, test.users) {
+			t.Errorf("mentions(%q) = %+v, want only users %v", test.content, mentions, test.users)
+		}
+	}
+
+	if _, err := parseLinkedUsers("Steve"); err == nil {
+		t.Errorf("expected an error for a pair without a user id")
+	}
+}
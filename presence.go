@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// activityTypes are the activity types by the name used in
+// DISCRAFT_PRESENCE, see
+// https://discord.com/developers/docs/topics/gateway#activity-object-activity-types
+var activityTypes = map[string]int{
+	"playing":   0, // Playing {name}
+	"streaming": 1, // Streaming {details}
+	"listening": 2, // Listening to {name}
+	"watching":  3, // Watching {name}
+	"custom":    4, // {emoji} {state}
+	"competing": 5, // Competing in {name}
+}
+
+// defaultPresence is what discraft has always shown, e.g. "Playing is 3 players"
+const defaultPresence = `playing is {{if not .Online}}none because ping failed{{else if .Players}}{{.Count}} players{{else}}none{{end}}`
+
+// presenceData is what presence templates are rendered with
+type presenceData struct {
+	Online  bool     // whether the last ping of the server succeeded
+	Players []string // the names of the online players
+	Count   int      // the number of online players
+	Max     int      // the maximum number of players
+	MOTD    string   // the message of the day, without formatting codes
+	Uptime  string   // how long the server has been up, e.g. "3h 12m"
+}
+
+type presenceTemplate struct {
+	activityType int
+	text         *template.Template
+}
+
+type presenceConfig struct {
+	templates []presenceTemplate
+	interval  time.Duration // how often to rotate between the templates
+}
+
+// parsePresenceConfig parses ';' separated presence templates, each starting
+// with an activity type, e.g. "watching {{.Count}} players;playing {{.MOTD}}"
+func parsePresenceConfig(spec string, interval string) (presenceConfig, error) {
+	config := presenceConfig{
+		interval: time.Minute,
+	}
+	if interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil || d <= 0 {
+			return config, fmt.Errorf("invalid rotation interval %q", interval)
+		}
+		config.interval = d
+	}
+	if spec == "" {
+		spec = defaultPresence
+	}
+
+	funcs := template.FuncMap{
+		"join": strings.Join,
+	}
+	for i, part := range strings.Split(spec, ";") {
+		part = strings.TrimSpace(part)
+		typeName, text, _ := strings.Cut(part, " ")
+		activityType, ok := activityTypes[strings.ToLower(typeName)]
+		if !ok {
+			return config, fmt.Errorf("presence %d has unknown activity type %q", i+1, typeName)
+		}
+		text = strings.TrimSpace(text)
+		if text == "" {
+			return config, fmt.Errorf("presence %d has no text after %q", i+1, typeName)
+		}
+		tmpl, err := template.New(fmt.Sprintf("presence %d", i+1)).Funcs(funcs).Parse(text)
+		if err != nil {
+			return config, fmt.Errorf("parsing presence %d: %w", i+1, err)
+		}
+		config.templates = append(config.templates, presenceTemplate{
+			activityType: activityType,
+			text:         tmpl,
+		})
+	}
+	return config, nil
+}
+
+func (t presenceTemplate) render(data presenceData) (activityObject, error) {
+	var text strings.Builder
+	if err := t.text.Execute(&text, data); err != nil {
+		return activityObject{}, fmt.Errorf("rendering %s: %w", t.text.Name(), err)
+	}
+	if t.activityType == activityTypes["custom"] {
+		return activityObject{
+			Type:  t.activityType,
+			Name:  "Custom Status",
+			State: text.String(),
+		}, nil
+	}
+	return activityObject{
+		Type: t.activityType,
+		Name: text.String(),
+	}, nil
+}
+
+// formatUptime formats d with its two most significant units, e.g. "2d 3h"
+func formatUptime(d time.Duration) string {
+	days := int(d / (24 * time.Hour))
+	hours := int(d/time.Hour) % 24
+	minutes := int(d/time.Minute) % 60
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd %dh", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	}
+	return fmt.Sprintf("%dm", minutes)
+}
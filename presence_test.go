@@ -0,0 +1,103 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParsePresenceConfig(t *testing.T) {
+	online := presenceData{Online: true, Players: []string{"Steve", "Alex"}, Count: 2, Max: 20, MOTD: "hello"}
+	tests := []struct {
+		spec     string
+		interval string
+		want     []activityObject
+		every    time.Duration
+		err      bool
+	}{
+		{"", "", []activityObject{{Type: 0, Name: "is 2 players"}}, time.Minute, false},
+		{"watching {{.Count}}/{{.Max}} players; Listening {{.MOTD}}", "30s", []activityObject{
+			{Type: 3, Name: "2/20 players"},
+			{Type: 2, Name: "hello"},
+		}, 30 * time.Second, false},
+		{"custom {{join .Players \", \"}} online", "", []activityObject{
+			{Type: 4, Name: "Custom Status", State: "Steve, Alex online"},
+		}, time.Minute, false},
+		{"watching", "", nil, 0, true},
+		{"playing {{.Count}};watching  ", "", nil, 0, true},
+		{"dancing {{.Count}}", "", nil, 0, true},
+		{"playing {{.Count", "", nil, 0, true},
+		{"playing {{.Count}}", "soon", nil, 0, true},
+		{"playing {{.Count}}", "-1m", nil, 0, true},
+	}
+	for _, test := range tests {
+		config, err := parsePresenceConfig(test.spec, test.interval)
+		if test.err {
+			if err == nil {
+				t.Errorf("parsePresenceConfig(%q, %q) succeeded, want an error", test.spec, test.interval)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parsePresenceConfig(%q, %q): %+v", test.spec, test.interval, err)
+			continue
+		}
+		if config.interval != test.every {
+			t.Errorf("parsePresenceConfig(%q, %q) rotates every %v, want %v", test.spec, test.interval, config.interval, test.every)
+		}
+		if len(config.templates) != len(test.want) {
+			t.Errorf("parsePresenceConfig(%q, %q) has %d templates, want %d", test.spec, test.interval, len(config.templates), len(test.want))
+			continue
+		}
+		for i, tmpl := range config.templates {
+			activity, err := tmpl.render(online)
+			if err != nil {
+				t.Errorf("rendering %q: %+v", test.spec, err)
+			} else if activity != test.want[i] {
+				t.Errorf("presence %d of %q is %+v, want %+v", i+1, test.spec, activity, test.want[i])
+			}
+		}
+	}
+}
+
+func TestDefaultPresence(t *testing.T) {
+	config, err := parsePresenceConfig("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		data presenceData
+		want string
+	}{
+		{presenceData{}, "is none because ping failed"},
+		{presenceData{Online: true}, "is none"},
+		{presenceData{Online: true, Players: []string{"Steve"}, Count: 1}, "is 1 players"},
+	}
+	for _, test := range tests {
+		activity, err := config.templates[0].render(test.data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if activity.Name != test.want {
+			t.Errorf("render(%+v) = %q, want %q", test.data, activity.Name, test.want)
+		}
+	}
+}
+
+func TestFormatUptime(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "0m"},
+		{59 * time.Second, "0m"},
+		{42 * time.Minute, "42m"},
+		{3*time.Hour + 12*time.Minute + 5*time.Second, "3h 12m"},
+		{24 * time.Hour, "1d 0h"},
+		{50*time.Hour + 30*time.Minute, "2d 2h"},
+	}
+	for _, test := range tests {
+		if got := formatUptime(test.d); got != test.want {
+			t.Errorf("formatUptime(%v) = %q, want %q", test.d, got, test.want)
+		}
+	}
+}
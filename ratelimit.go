@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// majorParameters are the path segments whose id is part of the rate limit
+// bucket, see https://discord.com/developers/docs/topics/rate-limits#rate-limits
+var majorParameters = map[string]bool{
+	"channels": true,
+	"guilds":   true,
+	"webhooks": true,
+}
+
+// tokenParameters are the path segments followed by an id and a token
+var tokenParameters = map[string]bool{
+	"webhooks":     true,
+	"interactions": true,
+}
+
+// route returns the rate limit route of a request and its major parameters.
+// Ids other than the major parameters are replaced, so that e.g. editing
+// different messages in a channel maps to the same route.
+func route(method string, path string) (string, string) {
+	path = strings.TrimPrefix(path, strings.TrimPrefix(discordBaseURL, "https://discord.com"))
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	var major []string
+	for i, segment := range segments {
+		if i >= 2 && tokenParameters[segments[i-2]] {
+			segments[i] = ":token" // keep tokens out of the logs
+			continue
+		}
+		if !isSnowflake(segment) || i == 0 {
+			continue
+		}
+		if majorParameters[segments[i-1]] {
+			major = append(major, segments[i-1]+"/"+segment)
+			continue
+		}
+		segments[i] = ":id"
+	}
+	return method + " /" + strings.Join(segments, "/"), strings.Join(major, "/")
+}
+
+func isSnowflake(s string) bool {
+	_, err := strconv.ParseUint(s, 10, 64)
+	return err == nil
+}
+
+// rateLimiter tracks the rate limit buckets discord reports through the
+// X-RateLimit-* headers and queues requests per bucket
+type rateLimiter struct {
+	sync.Mutex                    // protect the maps and the buckets
+	routes     map[string]string  // route to X-RateLimit-Bucket hash
+	buckets    map[string]*bucket // bucket hash and major parameters to bucket
+	global     time.Time          // no requests are sent until this time
+}
+
+// bucket is a rate limit bucket. Only one request per bucket is in flight at
+// a time, so the remaining count is always up to date when the next request
+// is sent.
+type bucket struct {
+	queue     chan struct{} // held while a request is in flight, waiters are served in order
+	remaining int
+	reset     time.Time
+	known     bool // whether discord has told us about the limits
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		routes:  map[string]string{},
+		buckets: map[string]*bucket{},
+	}
+}
+
+// getBucket returns the bucket for a route. Until discord has told us the
+// bucket hash of a route, the route itself is used.
+func (rl *rateLimiter) getBucket(route string, major string) *bucket {
+	key := route + ":" + major
+	if hash, ok := rl.routes[route]; ok {
+		key = hash + ":" + major
+	}
+	b, ok := rl.buckets[key]
+	if !ok {
+		b = &bucket{
+			queue: make(chan struct{}, 1),
+		}
+		rl.buckets[key] = b
+	}
+	return b
+}
+
+// wait returns how long to wait before the bucket has requests left, and
+// takes one of the remaining requests if there is no need to wait
+func (b *bucket) wait() time.Duration {
+	if !b.known || b.remaining > 0 {
+		b.remaining--
+		return 0
+	}
+	wait := time.Until(b.reset)
+	if wait <= 0 {
+		b.known = false // the bucket has reset, the response tells us the new limits
+	}
+	return wait
+}
+
+// pause stops all requests for d, used when discord reports that we hit the
+// global rate limit
+func (rl *rateLimiter) pause(d time.Duration) {
+	rl.Lock()
+	defer rl.Unlock()
+	if until := time.Now().Add(d); until.After(rl.global) {
+		rl.global = until
+	}
+}
+
+// acquire waits for our turn in the bucket of req and until the bucket has
+// requests left and no global pause is in effect. The returned function has to be called with the response to
+// update the bucket and let the next request through.
+func (rl *rateLimiter) acquire(req *http.Request) func(*http.Response) {
+	r, major := route(req.Method, req.URL.Path)
+	rl.Lock()
+	b := rl.getBucket(r, major)
+	rl.Unlock()
+
+	b.queue <- struct{}{}
+	for {
+		rl.Lock()
+		wait := time.Until(rl.global)
+		if wait <= 0 {
+			wait = b.wait()
+		}
+		rl.Unlock()
+		if wait <= 0 {
+			break
+		}
+		fmt.Printf("Hit rate limit for %s, waiting for %v\n", r, wait)
+		time.Sleep(wait)
+	}
+
+	return func(res *http.Response) {
+		defer func() { <-b.queue }()
+		if res == nil {
+			return
+		}
+		remaining, err := strconv.Atoi(res.Header.Get("X-RateLimit-Remaining"))
+		if err != nil {
+			return // the route is not rate limited
+		}
+		resetAfter, err := strconv.ParseFloat(res.Header.Get("X-RateLimit-Reset-After"), 64)
+		if err != nil {
+			fmt.Printf("Failed to parse X-RateLimit-Reset-After header: %#v\n", err)
+			return
+		}
+		reset := time.Now().Add(time.Duration(resetAfter * float64(time.Second)))
+
+		rl.Lock()
+		defer rl.Unlock()
+		buckets := []*bucket{b}
+		if hash := res.Header.Get("X-RateLimit-Bucket"); hash != "" && rl.routes[r] != hash {
+			// Requests already queued on the old bucket still go through it,
+			// new requests use the bucket shared by all routes of the hash
+			rl.routes[r] = hash
+			buckets = append(buckets, rl.getBucket(r, major))
+		}
+		for _, b := range buckets {
+			b.remaining = remaining
+			b.reset = reset
+			b.known = true
+		}
+	}
+}
+
+// https://discord.com/developers/docs/topics/rate-limits#exceeding-a-rate-limit-rate-limit-response-structure
+type rateLimitResp struct {
+	Message    string  `json:"message"`     // a message saying you are being rate limited
+	RetryAfter float64 `json:"retry_after"` // the number of seconds to wait before submitting another request
+	Global     bool    `json:"global"`      // a value indicating if you are being globally rate limited or not
+	Code       int     `json:"code"`        // an error code for some limits
+}
+
+// rateLimited parses a 429 response into how long to wait and whether the
+// limit is global. The body is consumed.
+func rateLimited(res *http.Response) (time.Duration, bool) {
+	rlResp := rateLimitResp{}
+	if err := json.NewDecoder(res.Body).Decode(&rlResp); err != nil {
+		fmt.Printf("Failed to parse rate limit response: %#v\n", err)
+	}
+	retryAfter := rlResp.RetryAfter
+	if retryAfter <= 0 {
+		// The Retry-After header is in whole seconds, prefer the body
+		retryAfter, _ = strconv.ParseFloat(res.Header.Get("Retry-After"), 64)
+	}
+	if retryAfter <= 0 {
+		retryAfter = 1
+	}
+	global := rlResp.Global || res.Header.Get("X-RateLimit-Global") == "true"
+	return time.Duration(retryAfter * float64(time.Second)), global
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRoute(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		route  string
+		major  string
+	}{
+		{"POST", "/api/channels/123/messages", "POST /channels/123/messages", "channels/123"},
+		{"PATCH", "/api/channels/123/messages/456", "PATCH /channels/123/messages/:id", "channels/123"},
+		{"GET", "/api/gateway/bot", "GET /gateway/bot", ""},
+		{"POST", "/api/webhooks/5/token", "POST /webhooks/5/:token", "webhooks/5"},
+		{"POST", "/api/interactions/7/token/callback", "POST /interactions/:id/:token/callback", ""},
+	}
+	for _, test := range tests {
+		route, major := route(test.method, test.path)
+		if route != test.route || major != test.major {
+			t.Errorf("route(%q, %q) = %q, %q, want %q, %q", test.method, test.path, route, major, test.route, test.major)
+		}
+	}
+}
+
+func TestBucketWait(t *testing.T) {
+	tests := []struct {
+		name      string
+		bucket    bucket
+		wait      bool // whether wait returns a positive duration
+		remaining int  // remaining after wait
+		known     bool // known after wait
+	}{
+		{"unknown", bucket{}, false, -1, false},
+		{"remaining", bucket{known: true, remaining: 2, reset: time.Now().Add(time.Hour)}, false, 1, true},
+		{"exhausted", bucket{known: true, remaining: 0, reset: time.Now().Add(time.Hour)}, true, 0, true},
+		{"reset", bucket{known: true, remaining: 0, reset: time.Now().Add(-time.Second)}, false, 0, false},
+	}
+	for _, test := range tests {
+		b := test.bucket
+		if wait := b.wait(); (wait > 0) != test.wait {
+			t.Errorf("%s: wait() = %v, want waiting %v", test.name, wait, test.wait)
+		}
+		if b.remaining != test.remaining || b.known != test.known {
+			t.Errorf("%s: remaining %d and known %v after wait, want %d and %v", test.name, b.remaining, b.known, test.remaining, test.known)
+		}
+	}
+}
+
+// fakeTransport answers requests without a network
+type fakeTransport func(req *http.Request) *http.Response
+
+func (f fakeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req), nil
+}
+
+func fakeResponse(status int, headers map[string]string, body string) *http.Response {
+	res := &http.Response{
+		StatusCode: status,
+		Status:     http.StatusText(status),
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+	for name, value := range headers {
+		res.Header.Set(name, value)
+	}
+	return res
+}
+
+func fakeRESTClient(transport fakeTransport) *restClient {
+	return &restClient{
+		client:  &http.Client{Transport: transport},
+		limiter: newRateLimiter(),
+	}
+}
+
+func get(t *testing.T, rc *restClient, path string) {
+	t.Helper()
+	req, err := http.NewRequest("GET", discordBaseURL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := rc.doReq(req)
+	if err != nil {
+		t.Errorf("GET %s failed: %+v", path, err)
+		return
+	}
+	res.Body.Close()
+}
+
+func TestRateLimiterQueuesPerBucket(t *testing.T) {
+	var mu sync.Mutex
+	inFlight := map[string]int{}
+	maxInFlight := map[string]int{}
+	total, maxTotal := 0, 0
+	rc := fakeRESTClient(func(req *http.Request) *http.Response {
+		mu.Lock()
+		inFlight[req.URL.Path]++
+		if inFlight[req.URL.Path] > maxInFlight[req.URL.Path] {
+			maxInFlight[req.URL.Path] = inFlight[req.URL.Path]
+		}
+		total++
+		if total > maxTotal {
+			maxTotal = total
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		inFlight[req.URL.Path]--
+		total--
+		mu.Unlock()
+		return fakeResponse(200, nil, "{}")
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		for _, path := range []string{"/channels/1/messages", "/channels/2/messages"} {
+			path := path
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				get(t, rc, path)
+			}()
+		}
+	}
+	wg.Wait()
+
+	// Each channel is its own bucket, which has one request in flight at a
+	// time, but the channels do not wait for each other
+	for path, max := range maxInFlight {
+		if max != 1 {
+			t.Errorf("%d requests to %s in flight at once, want 1", max, path)
+		}
+	}
+	if maxTotal != 2 {
+		t.Errorf("%d requests in flight at once, want one per channel", maxTotal)
+	}
+}
+
+func TestRateLimiterWaitsForReset(t *testing.T) {
+	var mu sync.Mutex
+	var sent []time.Time
+	rc := fakeRESTClient(func(req *http.Request) *http.Response {
+		mu.Lock()
+		sent = append(sent, time.Now())
+		mu.Unlock()
+		return fakeResponse(200, map[string]string{
+			"X-RateLimit-Remaining":   "0",
+			"X-RateLimit-Reset-After": "0.1",
+		}, "{}")
+	})
+
+	get(t, rc, "/channels/1/messages")
+	get(t, rc, "/channels/1/messages")
+	get(t, rc, "/channels/2/messages") // another major parameter, not limited
+
+	if len(sent) != 3 {
+		t.Fatalf("sent %d requests, want 3", len(sent))
+	}
+	if d := sent[1].Sub(sent[0]); d < 90*time.Millisecond {
+		t.Errorf("second request sent after %v, want it to wait for the reset", d)
+	}
+	if d := sent[2].Sub(sent[1]); d > 50*time.Millisecond {
+		t.Errorf("request to another channel waited %v", d)
+	}
+}
+
+func TestRateLimiterSharedBucket(t *testing.T) {
+	var mu sync.Mutex
+	var sent []time.Time
+	rc := fakeRESTClient(func(req *http.Request) *http.Response {
+		mu.Lock()
+		sent = append(sent, time.Now())
+		remaining := "1"
+		if req.Method == "DELETE" {
+			remaining = "0"
+		}
+		mu.Unlock()
+		// Both routes share the bucket abc
+		return fakeResponse(200, map[string]string{
+			"X-RateLimit-Bucket":      "abc",
+			"X-RateLimit-Remaining":   remaining,
+			"X-RateLimit-Reset-After": "0.1",
+		}, "{}")
+	})
+
+	get(t, rc, "/channels/1/messages/5")
+	req, _ := http.NewRequest("DELETE", discordBaseURL+"/channels/1/messages/6", nil)
+	if res, err := rc.doReq(req); err != nil {
+		t.Fatal(err)
+	} else {
+		res.Body.Close()
+	}
+
+	getRoute, major := route("GET", "/api/channels/1/messages/5")
+	deleteRoute, _ := route("DELETE", "/api/channels/1/messages/6")
+	rc.limiter.Lock()
+	shared := rc.limiter.getBucket(getRoute, major) == rc.limiter.getBucket(deleteRoute, major)
+	rc.limiter.Unlock()
+	if !shared {
+		t.Errorf("%s and %s do not share the bucket of their hash", getRoute, deleteRoute)
+	}
+
+	// The DELETE used up the shared bucket, so the GET has to wait
+	get(t, rc, "/channels/1/messages/5")
+	if d := sent[2].Sub(sent[1]); d < 90*time.Millisecond {
+		t.Errorf("request on the shared bucket sent after %v, want it to wait for the reset", d)
+	}
+}
+
+func TestRateLimitRetry(t *testing.T) {
+	calls := 0
+	rc := fakeRESTClient(func(req *http.Request) *http.Response {
+		calls++
+		if calls == 1 {
+			return fakeResponse(429, map[string]string{"X-RateLimit-Scope": "user"}, `{"message":"You are being rate limited.","retry_after":0.05,"global":false}`)
+		}
+		return fakeResponse(200, nil, "{}")
+	})
+
+	start := time.Now()
+	get(t, rc, "/channels/1/messages")
+	if calls != 2 {
+		t.Errorf("sent %d requests, want the rate limited one retried once", calls)
+	}
+	if took := time.Since(start); took < 50*time.Millisecond {
+		t.Errorf("retried after %v, want at least retry_after", took)
+	}
+	if retries, global := rc.retries(); retries != 1 || global != 0 {
+		t.Errorf("retries() = %d, %d, want 1, 0", retries, global)
+	}
+}
+
+func TestGlobalRateLimit(t *testing.T) {
+	var mu sync.Mutex
+	limited := make(chan time.Time, 1)
+	var otherSent time.Time
+	calls := 0
+	rc := fakeRESTClient(func(req *http.Request) *http.Response {
+		mu.Lock()
+		defer mu.Unlock()
+		if req.URL.Path == "/api/channels/2/messages" {
+			otherSent = time.Now()
+			return fakeResponse(200, nil, "{}")
+		}
+		calls++
+		if calls == 1 {
+			limited <- time.Now()
+			return fakeResponse(429, map[string]string{"X-RateLimit-Global": "true"}, `{"message":"You are being rate limited.","retry_after":0.1,"global":true}`)
+		}
+		return fakeResponse(200, nil, "{}")
+	})
+
+	done := make(chan struct{})
+	go func() {
+		get(t, rc, "/channels/1/messages")
+		close(done)
+	}()
+	limitedAt := <-limited
+	for paused := false; !paused; time.Sleep(time.Millisecond) {
+		rc.limiter.Lock()
+		paused = rc.limiter.global.After(time.Now())
+		rc.limiter.Unlock()
+	}
+	get(t, rc, "/channels/2/messages")
+	<-done
+
+	// The global limit pauses requests on all routes
+	mu.Lock()
+	defer mu.Unlock()
+	if d := otherSent.Sub(limitedAt); d < 90*time.Millisecond {
+		t.Errorf("request on another route sent %v after the global rate limit, want it paused", d)
+	}
+	if retries, global := rc.retries(); retries != 1 || global != 1 {
+		t.Errorf("retries() = %d, %d, want 1, 1", retries, global)
+	}
+}
+
+func TestRateLimitGivesUp(t *testing.T) {
+	calls := 0
+	rc := fakeRESTClient(func(req *http.Request) *http.Response {
+		calls++
+		return fakeResponse(429, nil, `{"message":"You are being rate limited.","retry_after":0.001,"global":false}`)
+	})
+
+	req, err := http.NewRequest("GET", discordBaseURL+"/channels/1/messages", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = rc.doReq(req)
+	var apiErr *discordAPIError
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusTooManyRequests {
+		t.Errorf("doReq() = %v, want a 429 error", err)
+	}
+	if calls != maxRateLimitRetries+1 {
+		t.Errorf("sent %d requests, want %d", calls, maxRateLimitRetries+1)
+	}
+	if retries, _ := rc.retries(); retries != maxRateLimitRetries {
+		t.Errorf("retries() = %d, want %d", retries, maxRateLimitRetries)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// RCON packet types, see https://wiki.vg/RCON
+const (
+	rconResponse = 0
+	rconCommand  = 2
+	rconLogin    = 3
+)
+
+// rconTimeout limits how long a command may take, including connecting
+const rconTimeout = 5 * time.Second
+
+var errRCONAuth = errors.New("RCON password rejected")
+
+// rconClient runs commands on the minecraft server through RCON
+type rconClient struct {
+	addr     string
+	password string
+}
+
+// run logs in and runs command, returning the response of the server
+func (rc *rconClient) run(command string) (string, error) {
+	conn, err := net.DialTimeout("tcp", rc.addr, rconTimeout)
+	if err != nil {
+		return "", fmt.Errorf("connecting to RCON: %w", err)
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(rconTimeout)); err != nil {
+		return "", err
+	}
+
+	if err := writeRCONPacket(conn, 1, rconLogin, rc.password); err != nil {
+		return "", fmt.Errorf("logging in: %w", err)
+	}
+	id, _, _, err := readRCONPacket(conn)
+	if err != nil {
+		return "", fmt.Errorf("logging in: %w", err)
+	}
+	if id == -1 {
+		return "", errRCONAuth
+	}
+
+	if err := writeRCONPacket(conn, 2, rconCommand, command); err != nil {
+		return "", fmt.Errorf("sending command: %w", err)
+	}
+	_, packetType, body, err := readRCONPacket(conn)
+	if err != nil {
+		return "", fmt.Errorf("reading response: %w", err)
+	}
+	if packetType != rconResponse {
+		return "", fmt.Errorf("unexpected RCON packet type %d", packetType)
+	}
+	return body, nil
+}
+
+// writeRCONPacket writes a packet: length, request id, type, a null
+// terminated body and an empty null terminated string, little endian
+func writeRCONPacket(w io.Writer, id int32, packetType int32, body string) error {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, int32(4+4+len(body)+2))
+	binary.Write(&buf, binary.LittleEndian, id)
+	binary.Write(&buf, binary.LittleEndian, packetType)
+	buf.WriteString(body)
+	buf.Write([]byte{0, 0})
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func readRCONPacket(r io.Reader) (int32, int32, string, error) {
+	var length int32
+	if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
+		return 0, 0, "", err
+	}
+	if length < 10 || length > 4096+10 {
+		return 0, 0, "", fmt.Errorf("invalid RCON packet length %d", length)
+	}
+	packet := make([]byte, length)
+	if _, err := io.ReadFull(r, packet); err != nil {
+		return 0, 0, "", err
+	}
+	id := int32(binary.LittleEndian.Uint32(packet[0:4]))
+	packetType := int32(binary.LittleEndian.Uint32(packet[4:8]))
+	body := string(bytes.TrimRight(packet[8:], "\x00"))
+	return id, packetType, body, nil
+}
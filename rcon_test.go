@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+// fakeRCONServer answers one connection like a minecraft server would
+func fakeRCONServer(t *testing.T, password string) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		id, _, body, err := readRCONPacket(conn)
+		if err != nil {
+			return
+		}
+		if body != password {
+			id = -1
+		}
+		writeRCONPacket(conn, id, rconCommand, "")
+		id, _, body, err = readRCONPacket(conn)
+		if err != nil {
+			return
+		}
+		writeRCONPacket(conn, id, rconResponse, "ran "+body)
+	}()
+	return l.Addr().String()
+}
+
+func TestRCON(t *testing.T) {
+	rcon := &rconClient{addr: fakeRCONServer(t, "secret"), password: "secret"}
+	res, err := rcon.run("whitelist add Steve")
+	if err != nil || res != "ran whitelist add Steve" {
+		t.Errorf("run() = %q, %+v", res, err)
+	}
+
+	rcon = &rconClient{addr: fakeRCONServer(t, "secret"), password: "wrong"}
+	if _, err := rcon.run("whitelist add Steve"); !errors.Is(err, errRCONAuth) {
+		t.Errorf("run() with the wrong password = %+v, want %v", err, errRCONAuth)
+	}
+}
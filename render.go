@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// markdownReplacer escapes the characters discord renders as formatting
+var markdownReplacer = strings.NewReplacer(
+	`\`, `\\`,
+	`*`, `\*`,
+	`_`, `\_`,
+	`~`, `\~`,
+	"`", "\\`",
+	`|`, `\|`,
+	`>`, `\>`,
+	`#`, `\#`,
+	`[`, `\[`,
+	`]`, `\]`,
+)
+
+// escapeMarkdown makes s show up in discord exactly as written
+func escapeMarkdown(s string) string {
+	return markdownReplacer.Replace(s)
+}
+
+// escapeMarkdownExcept escapes s like escapeMarkdown, but leaves the matches
+// of keep as they are, such as mentions which escaping would break
+func escapeMarkdownExcept(s string, keep *regexp.Regexp) string {
+	var b strings.Builder
+	last := 0
+	for _, match := range keep.FindAllStringIndex(s, -1) {
+		b.WriteString(escapeMarkdown(s[last:match[0]]))
+		b.WriteString(s[match[0]:match[1]])
+		last = match[1]
+	}
+	b.WriteString(escapeMarkdown(s[last:]))
+	return b.String()
+}
+
+// stripFormatting removes minecraft § formatting codes
+func stripFormatting(s string) string {
+	return formattingCodeRegex.ReplaceAllString(s, "")
+}
+
+var ampersandCodeRegex = regexp.MustCompile(`&[0-9a-fk-orA-FK-OR]`)
+
+// ansiCodes maps minecraft formatting codes to the ANSI codes discord
+// supports in ansi code blocks, see https://minecraft.wiki/w/Formatting_codes
+var ansiCodes = map[byte]string{
+	'0': "30", '1': "34", '2': "32", '3': "36",
+	'4': "31", '5': "35", '6': "33", '7': "37",
+	'8': "30", '9': "34", 'a': "32", 'b': "36",
+	'c': "31", 'd': "35", 'e': "33", 'f': "37",
+	'l': "1", 'n': "4", 'r': "0",
+}
+
+// chatRenderer turns minecraft chat into discord messages
+type chatRenderer struct {
+	ansi   bool        // render &-style color codes as an ansi code block
+	linked linkedUsers // players that may ping discord users
+}
+
+// chat renders a chat message of a player
+func (r chatRenderer) chat(user string, msg string) messageCreateParams {
+	return r.render(stripFormatting(user), msg)
+}
+
+// webhookChat renders a chat message of a player without the name, for
+// messages sent with the name of the player
+func (r chatRenderer) webhookChat(msg string) messageCreateParams {
+	return r.render("", msg)
+}
+
+func (r chatRenderer) render(user string, msg string) messageCreateParams {
+	msg = stripFormatting(msg)
+	if r.ansi && ampersandCodeRegex.MatchString(msg) {
+		if user != "" {
+			msg = fmt.Sprintf("<%s> %s", user, msg)
+		}
+		// Mentions do not work inside code blocks
+		return messageCreateParams{
+			Content:         ansiBlock(msg + "&r"),
+			AllowedMentions: noMentions(),
+		}
+	}
+	content, mentions := r.linked.mentions(msg)
+	content = escapeMarkdownExcept(content, userMentionRegex)
+	if user != "" {
+		content = fmt.Sprintf("<%s> %s", escapeMarkdown(user), content)
+	}
+	return messageCreateParams{
+		Content:         content,
+		AllowedMentions: mentions,
+	}
+}
+
+// ansiBlock renders the &-style color codes of s in an ansi code block
+func ansiBlock(s string) string {
+	s = ampersandCodeRegex.ReplaceAllStringFunc(s, func(code string) string {
+		ansi, ok := ansiCodes[strings.ToLower(code)[1]]
+		if !ok {
+			return "" // obfuscated, strikethrough and italic have no ANSI code in discord
+		}
+		return "\x1b[" + ansi + "m"
+	})
+	// A zero width space keeps the content from closing the code block
+	s = strings.ReplaceAll(s, "```", "`​``")
+	return "```ansi\n" + s + "\n```"
+}
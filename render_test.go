@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestChatRenderer(t *testing.T) {
+	tests := []struct {
+		ansi bool
+		user string
+		msg  string
+		want string
+	}{
+		{false, "__foo__", "*hi* ~~there~~", `<\_\_foo\_\_> \*hi\* \~\~there\~\~`},
+		{false, "bar", "```oops", "<bar> \\`\\`\\`oops"},
+		{false, "§cbaz", "§lspoiler ||x|| > quote", `<baz> spoiler \|\|x\|\| \> quote`},
+		{false, "bar", "&ctext", "<bar> &ctext"},
+		{false, "bar", "hi @steve", "<bar> hi <@123>"},
+		{false, "bar", "@Steve > @steve_fan", `<bar> <@123> \> @steve\_fan`},
+		{true, "bar", "plain", "<bar> plain"},
+		{true, "bar", "&cred &lbold&r ```", "```ansi\n<bar> \x1b[31mred \x1b[1mbold\x1b[0m `​``\x1b[0m\n```"},
+	}
+	linked, err := parseLinkedUsers("Steve:123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		r := chatRenderer{ansi: test.ansi, linked: linked}
+		if got := r.chat(test.user, test.msg).Content; got != test.want {
+			t.Errorf("chat(%q, %q) = %q, want %q", test.user, test.msg, got, test.want)
+		}
+	}
+}
@@ -2,133 +2,337 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
-	"strconv"
-	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// maxRateLimitRetries is how many times a request is retried after hitting
+// a rate limit before giving up
+const maxRateLimitRetries = 5
+
 type restClient struct {
-	sync.Mutex // protect the limits
-	client     *http.Client
-	limits     map[string]rateLimit
-}
+	client  *http.Client
+	limiter *rateLimiter
 
-type rateLimit struct {
-	resets    time.Time
-	remaining int
+	rateLimitRetries       int64 // requests retried after a 429, use atomic
+	globalRateLimitRetries int64 // the subset of rateLimitRetries that hit the global limit, use atomic
 }
 
-func (l *rateLimit) Wait() {
-	if l == nil {
-		return
-	}
-	if l.remaining == 0 {
-		waitFor := l.resets.Sub(time.Now())
-		fmt.Printf("Hit rate limit, waiting for %v", waitFor)
-		time.Sleep(waitFor)
-	}
-}
+// restTimeout limits how long a single request may take, so that a stalled
+// connection fails and can be retried
+const restTimeout = 30 * time.Second
 
 func newRESTClient() *restClient {
 	return &restClient{
-		client: &http.Client{},
-		limits: map[string]rateLimit{},
+		client:  &http.Client{Timeout: restTimeout},
+		limiter: newRateLimiter(),
 	}
 }
 
-func (rc *restClient) doReq(req *http.Request) (*http.Response, error) {
-	req.Header.Add("Authorization", "Bot "+os.Getenv("DISCRAFT_TOKEN"))
-	rc.getLimit(req).Wait()
-	res, err := rc.client.Do(req)
-	rc.updateLimits(res)
-	return res, err
-}
+// maxTransientRetries is how many times an idempotent request is retried
+// after a network error or a 5xx response
+const maxTransientRetries = 4
+
+type idempotentKey struct{}
 
-func getBucket(req *http.Request) string {
-	// bucket := res.Header.Get("X-RateLimit-Bucket") // This bucket is not very useful when we can't calculate it ourselves. Lets just use a good guess on what it depends on
-	return req.Method + " " + req.URL.String()
+// idempotent marks a request as safe to send more than once, so that it is
+// retried after network errors and 5xx responses. GET, HEAD, PUT and DELETE
+// requests are always considered idempotent.
+func idempotent(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), idempotentKey{}, true))
 }
 
-func (rc *restClient) getLimit(req *http.Request) *rateLimit {
-	rc.Lock()
-	defer rc.Unlock()
-	if limit, ok := rc.limits[getBucket(req)]; ok {
-		return &limit
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
 	}
-	return nil
+	marked, _ := req.Context().Value(idempotentKey{}).(bool)
+	return marked
 }
 
-func (rc *restClient) updateLimits(res *http.Response) {
-	if res == nil {
-		return
-	}
-	remaining, err := strconv.Atoi(res.Header.Get("X-RateLimit-Remaining"))
-	if err != nil {
-		fmt.Printf("Failed to parse X-RateLimit-Remaining header: %#v", err)
-		return
-	}
-	resetEpoch, err := strconv.ParseInt(res.Header.Get("X-RateLimit-Reset"), 10, 64)
-	if err != nil {
-		fmt.Printf("Failed to parse X-RateLimit-Reset header: %#v", err)
-		return
+func (rc *restClient) doReq(req *http.Request) (*http.Response, error) {
+	req.Header.Add("Authorization", "Bot "+os.Getenv("DISCRAFT_TOKEN"))
+	canRetry := isIdempotent(req) && (req.Body == nil || req.GetBody != nil)
+	transient := backoff{
+		min: 500 * time.Millisecond,
+		max: 10 * time.Second,
 	}
-	resetTime := time.Unix(resetEpoch, 0)
+	rateLimits := 0
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("getting body for retry: %w", err)
+			}
+			req.Body = body
+		}
+		done := rc.limiter.acquire(req)
+		res, err := rc.client.Do(req)
+		done(res)
 
-	rc.Lock()
-	defer rc.Unlock()
+		if err != nil || res.StatusCode >= 500 {
+			if !canRetry || transient.attempt >= maxTransientRetries || req.Context().Err() != nil {
+				return res, err
+			}
+			wait := transient.next()
+			if err == nil {
+				err = fmt.Errorf("unexpected status %s", res.Status)
+				res.Body.Close()
+			}
+			r, _ := route(req.Method, req.URL.Path)
+			fmt.Printf("Request %s failed, retrying in %v: %+v\n", r, wait, err)
+			time.Sleep(wait)
+			continue
+		}
+		if res.StatusCode != http.StatusTooManyRequests {
+			return res, nil
+		}
 
-	rc.limits[getBucket(res.Request)] = rateLimit{
-		resets:    resetTime,
-		remaining: remaining,
+		retryAfter, global := rateLimited(res)
+		res.Body.Close()
+		if rateLimits >= maxRateLimitRetries || (req.Body != nil && req.GetBody == nil) {
+			return nil, &discordAPIError{
+				Status:  http.StatusTooManyRequests,
+				Message: fmt.Sprintf("rate limited %d times, giving up", rateLimits+1),
+			}
+		}
+		rateLimits++
+		atomic.AddInt64(&rc.rateLimitRetries, 1)
+		if global {
+			atomic.AddInt64(&rc.globalRateLimitRetries, 1)
+		}
+		retries, globalRetries := rc.retries()
+		r, _ := route(req.Method, req.URL.Path)
+		fmt.Printf("Rate limited on %s (global: %v, scope: %s), retrying in %v. Rate limited %d times since startup, %d of them globally\n",
+			r, global, res.Header.Get("X-RateLimit-Scope"), retryAfter, retries, globalRetries)
+		if global {
+			rc.limiter.pause(retryAfter)
+		} else {
+			time.Sleep(retryAfter)
+		}
 	}
 }
 
+// retries returns how many requests have been retried after hitting a rate
+// limit, and how many of those hit the global rate limit
+func (rc *restClient) retries() (int64, int64) {
+	return atomic.LoadInt64(&rc.rateLimitRetries), atomic.LoadInt64(&rc.globalRateLimitRetries)
+}
+
 // https://ptb.discord.com/developers/docs/topics/gateway#get-gateway-bot
 type gatewayResp struct {
-	URL string `json:"url"`
+	URL               string            `json:"url"`                 // WSS URL that can be used for connecting to the gateway
+	Shards            int               `json:"shards"`              // recommended number of shards to use when connecting
+	SessionStartLimit sessionStartLimit `json:"session_start_limit"` // information on the current session start limit
 }
 
-func (rc *restClient) getGatewayURL() (string, error) {
+// https://discord.com/developers/docs/topics/gateway#session-start-limit-object
+type sessionStartLimit struct {
+	Total          int `json:"total"`           // total number of session starts the current user is allowed
+	Remaining      int `json:"remaining"`       // remaining number of session starts the current user is allowed
+	ResetAfter     int `json:"reset_after"`     // number of milliseconds after which the limit resets
+	MaxConcurrency int `json:"max_concurrency"` // number of identify requests allowed per 5 seconds
+}
+
+func (rc *restClient) getGatewayBot() (*gatewayResp, error) {
 	req, err := http.NewRequest("GET", discordBaseURL+"/gateway/bot", nil)
 	if err != nil {
-		return "", fmt.Errorf("creating request: %w", err)
+		return nil, fmt.Errorf("creating request: %w", err)
 	}
 
 	res, err := rc.doReq(req)
 	if err != nil {
-		return "", fmt.Errorf("executing request: %w", err)
+		return nil, fmt.Errorf("executing request: %w", err)
 	}
 	defer res.Body.Close()
 
-	// TODO check res.Status
+	if res.StatusCode/100 != 2 {
+		return nil, newAPIError(res)
+	}
 
 	dec := json.NewDecoder(res.Body)
 	gResp := &gatewayResp{}
 	if err := dec.Decode(gResp); err != nil {
-		return "", fmt.Errorf("decoding response: %w", err)
+		return nil, fmt.Errorf("decoding response: %w", err)
 	}
 
-	return gResp.URL, nil
+	return gResp, nil
+}
+
+// https://discord.com/developers/docs/resources/channel#create-message-jsonform-params
+type messageCreateParams struct {
+	Content         string              `json:"content,omitempty"`          // message contents (up to 2000 characters)
+	Nonce           string              `json:"nonce,omitempty"`            // can be used to verify a message was sent (up to 25 characters)
+	Embeds          []embedObj          `json:"embeds,omitempty"`           // up to 10 rich embeds (up to 6000 characters)
+	AllowedMentions *allowedMentionsObj `json:"allowed_mentions,omitempty"` // allowed mentions for the message
+	Components      []componentObj      `json:"components,omitempty"`       // components to include with the message
+	EnforceNonce    bool                `json:"enforce_nonce"`              // if true and nonce is present, it will be checked for uniqueness in the past few minutes
 }
 
 // https://discord.com/developers/docs/resources/channel#create-message
-func (rc *restClient) createMessage(channel snowflake, content string) (*messageObj, error) {
+func (rc *restClient) createMessage(channel snowflake, params messageCreateParams) (*messageObj, error) {
 	createMSGURL := fmt.Sprintf("%s/channels/%s/messages", discordBaseURL, channel)
 
-	data, err := json.Marshal(map[string]interface{}{
-		"content": content,
+	nonce, err := newNonce()
+	if err != nil {
+		return nil, fmt.Errorf("creating nonce: %w", err)
+	}
+	// The nonce makes discord return the already created message if a retry
+	// reaches it twice, instead of posting the content again
+	params.Nonce = nonce
+	params.EnforceNonce = true
+	req, err := newJSONRequest("POST", createMSGURL, params)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &messageObj{}
+	if err := rc.doJSON(idempotent(req), msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// https://discord.com/developers/docs/resources/user#create-dm
+func (rc *restClient) createDM(recipient snowflake) (*channelObj, error) {
+	req, err := newJSONRequest("POST", discordBaseURL+"/users/@me/channels", map[string]snowflake{
+		"recipient_id": recipient,
+	})
+	if err != nil {
+		return nil, err
+	}
+	channel := &channelObj{}
+	if err := rc.doJSON(idempotent(req), channel); err != nil {
+		return nil, err
+	}
+	return channel, nil
+}
+
+// https://discord.com/developers/docs/resources/webhook#get-channel-webhooks
+func (rc *restClient) getChannelWebhooks(channel snowflake) ([]webhookObj, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/channels/%s/webhooks", discordBaseURL, channel), nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	webhooks := []webhookObj{}
+	if err := rc.doJSON(req, &webhooks); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// https://discord.com/developers/docs/resources/webhook#create-webhook
+func (rc *restClient) createWebhook(channel snowflake, name string) (*webhookObj, error) {
+	req, err := newJSONRequest("POST", fmt.Sprintf("%s/channels/%s/webhooks", discordBaseURL, channel), map[string]string{
+		"name": name,
 	})
+	if err != nil {
+		return nil, err
+	}
+	webhook := &webhookObj{}
+	if err := rc.doJSON(req, webhook); err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+// https://discord.com/developers/docs/resources/webhook#execute-webhook-jsonform-params
+type webhookExecuteParams struct {
+	Content         string              `json:"content,omitempty"`          // the message contents (up to 2000 characters)
+	Username        string              `json:"username,omitempty"`         // override the default username of the webhook
+	AvatarURL       string              `json:"avatar_url,omitempty"`       // override the default avatar of the webhook
+	Embeds          []embedObj          `json:"embeds,omitempty"`           // embedded rich content
+	AllowedMentions *allowedMentionsObj `json:"allowed_mentions,omitempty"` // allowed mentions for the message
+}
 
+// https://discord.com/developers/docs/resources/webhook#execute-webhook
+func (rc *restClient) executeWebhook(webhook *webhookObj, params webhookExecuteParams) (*messageObj, error) {
+	// wait makes discord confirm that the message was created
+	executeURL := fmt.Sprintf("%s/webhooks/%s/%s?wait=true", discordBaseURL, webhook.ID, webhook.Token)
+	req, err := newJSONRequest("POST", executeURL, params)
+	if err != nil {
+		return nil, err
+	}
+	msg := &messageObj{}
+	if err := rc.doJSON(req, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// https://discord.com/developers/docs/resources/webhook#edit-webhook-message-jsonform-params
+// The fields are not omitted when empty, so that an edit replaces the whole
+// message.
+type webhookEditMessageParams struct {
+	Content         string              `json:"content"`                    // the message contents (up to 2000 characters)
+	Embeds          []embedObj          `json:"embeds"`                     // embedded rich content
+	AllowedMentions *allowedMentionsObj `json:"allowed_mentions,omitempty"` // allowed mentions for the message
+	Components      []componentObj      `json:"components"`                 // the components to include with the message
+}
+
+// https://discord.com/developers/docs/interactions/receiving-and-responding#edit-original-interaction-response
+func (rc *restClient) editOriginalInteractionResponse(application snowflake, token string, params webhookEditMessageParams) error {
+	editURL := fmt.Sprintf("%s/webhooks/%s/%s/messages/@original", discordBaseURL, application, token)
+	req, err := newJSONRequest("PATCH", editURL, params)
+	if err != nil {
+		return err
+	}
+	return rc.doJSON(req, nil)
+}
+
+// https://discord.com/developers/docs/resources/application#get-current-application
+func (rc *restClient) getCurrentApplication() (*applicationObj, error) {
+	req, err := http.NewRequest("GET", discordBaseURL+"/applications/@me", nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	application := &applicationObj{}
+	if err := rc.doJSON(req, application); err != nil {
+		return nil, err
+	}
+	return application, nil
+}
+
+// https://discord.com/developers/docs/interactions/application-commands#bulk-overwrite-global-application-commands
+func (rc *restClient) bulkOverwriteGlobalCommands(application snowflake, commands []applicationCommandObj) ([]applicationCommandObj, error) {
+	req, err := newJSONRequest("PUT", fmt.Sprintf("%s/applications/%s/commands", discordBaseURL, application), commands)
+	if err != nil {
+		return nil, err
+	}
+	registered := []applicationCommandObj{}
+	if err := rc.doJSON(req, &registered); err != nil {
+		return nil, err
+	}
+	return registered, nil
+}
+
+// https://discord.com/developers/docs/interactions/receiving-and-responding#create-interaction-response
+func (rc *restClient) createInteractionResponse(interaction snowflake, token string, response interactionResponseObj) error {
+	req, err := newJSONRequest("POST", fmt.Sprintf("%s/interactions/%s/%s/callback", discordBaseURL, interaction, token), response)
+	if err != nil {
+		return err
+	}
+	return rc.doJSON(req, nil)
+}
+
+// newJSONRequest creates a request with body encoded as JSON, the body can be
+// sent again when the request is retried
+func newJSONRequest(method string, url string, body any) (*http.Request, error) {
+	data, err := json.Marshal(body)
 	if err != nil {
 		return nil, fmt.Errorf("marshaling JSON: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", createMSGURL, io.NopCloser(bytes.NewReader(data)))
+	req, err := http.NewRequest(method, url, io.NopCloser(bytes.NewReader(data)))
 	if err != nil {
 		return nil, fmt.Errorf("creating request: %w", err)
 	}
@@ -137,20 +341,41 @@ func (rc *restClient) createMessage(channel snowflake, content string) (*message
 	req.GetBody = func() (io.ReadCloser, error) {
 		return io.NopCloser(bytes.NewReader(data)), nil
 	}
+	return req, nil
+}
 
+// doJSON does req and decodes the response into result, unless result is
+// nil or the response has no content
+func (rc *restClient) doJSON(req *http.Request, result any) error {
 	res, err := rc.doReq(req)
 	if err != nil {
-		return nil, fmt.Errorf("doing request: %w", err)
+		return fmt.Errorf("doing request: %w", err)
 	}
 	defer res.Body.Close()
 
+	if res.StatusCode/100 != 2 {
+		return newAPIError(res)
+	}
+	if result == nil || res.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
 	body, err := io.ReadAll(res.Body)
 	if err != nil {
-		return nil, fmt.Errorf("reading entire response body: %w", err)
+		return fmt.Errorf("reading entire response body: %w", err)
 	}
-	msg := &messageObj{}
-	if err := json.Unmarshal(body, msg); err != nil {
-		return nil, fmt.Errorf("parsing JSON: %w", err)
+	if err := json.Unmarshal(body, result); err != nil {
+		return fmt.Errorf("parsing JSON: %w", err)
 	}
-	return msg, nil
+	return nil
+}
+
+// newNonce returns a random message nonce, discord allows at most 25
+// characters
+func newNonce() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
 }
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxSuggestions is the most choices discord accepts for autocomplete
+const maxSuggestions = 25
+
+// playerHistory remembers when every player was last seen, saved in the
+// state directory if there is one
+type playerHistory struct {
+	sync.Mutex
+	path     string               // where the history is saved, empty to only keep it in memory
+	lastSeen map[string]time.Time // player name to when the player was last seen online
+}
+
+// loadPlayerHistory reads the history from dir, an empty dir keeps the
+// history in memory only
+func loadPlayerHistory(dir string) (*playerHistory, error) {
+	h := &playerHistory{
+		lastSeen: map[string]time.Time{},
+	}
+	if dir == "" {
+		return h, nil
+	}
+	h.path = filepath.Join(dir, "players.json")
+	data, err := os.ReadFile(h.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return h, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("reading player history: %w", err)
+	}
+	if err := json.Unmarshal(data, &h.lastSeen); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", h.path, err)
+	}
+	return h, nil
+}
+
+// seen records that the players are online at t, the history is saved if
+// any of them have not been seen before or save is set
+func (h *playerHistory) seen(t time.Time, save bool, players ...string) {
+	h.Lock()
+	defer h.Unlock()
+	for _, player := range players {
+		if _, ok := h.lastSeen[player]; !ok {
+			save = true
+		}
+		h.lastSeen[player] = t
+	}
+	if save && h.path != "" {
+		if err := writeFileAtomic(h.path, h.lastSeen); err != nil {
+			fmt.Printf("Failed to save player history: %+v\n", err)
+		}
+	}
+}
+
+// get returns when player was last seen, the name is not case sensitive
+func (h *playerHistory) get(player string) (string, time.Time, bool) {
+	h.Lock()
+	defer h.Unlock()
+	for name, t := range h.lastSeen {
+		if strings.EqualFold(name, player) {
+			return name, t, true
+		}
+	}
+	return "", time.Time{}, false
+}
+
+// suggest returns the player names matching typed, online players first and
+// then by how recently they were seen. Names starting with typed are ranked
+// above names only containing it.
+func (h *playerHistory) suggest(typed string, online []string) []string {
+	h.Lock()
+	candidates := map[string]time.Time{}
+	for name, t := range h.lastSeen {
+		candidates[name] = t
+	}
+	h.Unlock()
+	now := time.Now()
+	for _, name := range online {
+		candidates[name] = now
+	}
+
+	type match struct {
+		name     string
+		prefix   bool
+		lastSeen time.Time
+	}
+	typed = strings.ToLower(typed)
+	matches := []match{}
+	for name, t := range candidates {
+		lower := strings.ToLower(name)
+		if !strings.Contains(lower, typed) {
+			continue
+		}
+		matches = append(matches, match{name: name, prefix: strings.HasPrefix(lower, typed), lastSeen: t})
+	}
+	sort.Slice(matches, func(a, b int) bool {
+		if matches[a].prefix != matches[b].prefix {
+			return matches[a].prefix
+		}
+		if !matches[a].lastSeen.Equal(matches[b].lastSeen) {
+			return matches[a].lastSeen.After(matches[b].lastSeen)
+		}
+		return matches[a].name < matches[b].name
+	})
+
+	names := []string{}
+	for _, m := range matches {
+		if len(names) == maxSuggestions {
+			break
+		}
+		names = append(names, m.name)
+	}
+	return names
+}
+
+// writeFileAtomic saves v as JSON to path, readers never see a partially
+// written file
+func writeFileAtomic(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling JSON: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("writing %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("renaming %s: %w", tmp, err)
+	}
+	return nil
+}
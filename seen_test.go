@@ -0,0 +1,34 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPlayerHistory(t *testing.T) {
+	dir := t.TempDir()
+	h, err := loadPlayerHistory(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	h.seen(now.Add(-3*time.Hour), true, "Steve", "xSteve")
+	h.seen(now.Add(-2*time.Hour), true, "Stella")
+	h.seen(now.Add(-time.Hour), true, "Alex")
+
+	got := h.suggest("ste", []string{"StevenOnline"})
+	want := []string{"StevenOnline", "Stella", "Steve", "xSteve"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("suggest(\"ste\") = %v, want %v", got, want)
+	}
+
+	loaded, err := loadPlayerHistory(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, lastSeen, ok := loaded.get("alex")
+	if !ok || name != "Alex" || !lastSeen.Equal(now.Add(-time.Hour).Round(0)) {
+		t.Errorf("get(\"alex\") after loading = %q, %v, %v", name, lastSeen, ok)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// shardGroup runs one gateway connection per shard, all feeding a single
+// event pipeline, see https://discord.com/developers/docs/topics/gateway#sharding
+type shardGroup struct {
+	sync.Mutex // protect the shards and the aggregated state
+	shards     []*gateway
+
+	restClient *restClient
+	token      string
+	compress   bool
+	count      int // 0 means use the count recommended by discord
+
+	state       gatewayState
+	subscribers []chan gatewayState
+	presence    *opUpdatePresence // the latest presence, used when identifying
+}
+
+// parseShardCount parses DISCRAFT_SHARDS, which is either a number of shards
+// or auto to use the count recommended by discord
+func parseShardCount(value string) (int, error) {
+	switch value {
+	case "":
+		return 1, nil
+	case "auto":
+		return 0, nil
+	}
+	count, err := strconv.Atoi(value)
+	if err != nil || count < 1 {
+		return 0, fmt.Errorf("expected a positive number or auto, got %q", value)
+	}
+	return count, nil
+}
+
+func newShardGroup(restClient *restClient, token string, compress bool, count int) *shardGroup {
+	return &shardGroup{
+		restClient: restClient,
+		token:      token,
+		compress:   compress,
+		count:      count,
+	}
+}
+
+// run connects all shards with the given intents and passes their dispatches
+// to handle, one at a time, until ctx is cancelled or a shard fails with an
+// unrecoverable error
+func (sg *shardGroup) run(ctx context.Context, intents int, handle func(*wsPayload)) error {
+	count, err := sg.shardCount(ctx)
+	if err != nil {
+		return nil // ctx was cancelled
+	}
+	fmt.Printf("Running %d gateway shard(s)\n", count)
+
+	identifies := newIdentifyLimiter()
+	sg.Lock()
+	for id := 0; id < count; id++ {
+		gw := newGateway(sg.restClient, sg.token, intents, sg.compress)
+		gw.shardID = id
+		gw.shardCount = count
+		gw.identifies = identifies
+		gw.presence = sg.currentPresence
+		sg.shards = append(sg.shards, gw)
+	}
+	shards := sg.shards
+	sg.Unlock()
+
+	// One failing shard stops all of them
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var fatal error
+	var fatalOnce sync.Once
+
+	events := make(chan *wsPayload)
+	var wg sync.WaitGroup
+	for _, gw := range shards {
+		gw := gw
+		states := gw.subscribe()
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-states:
+					sg.updateState()
+				}
+			}
+		}()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := gw.run(ctx, func(payload *wsPayload) {
+				select {
+				case <-ctx.Done():
+				case events <- payload:
+				}
+			})
+			if err != nil {
+				fatalOnce.Do(func() {
+					fatal = fmt.Errorf("shard %d: %w", gw.shardID, err)
+					cancel()
+				})
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(events)
+	}()
+
+	for payload := range events {
+		handle(payload)
+	}
+	return fatal
+}
+
+// shardCount returns the configured shard count, or the recommended one
+func (sg *shardGroup) shardCount(ctx context.Context) (int, error) {
+	if sg.count > 0 {
+		return sg.count, nil
+	}
+	b := backoff{
+		min: time.Second,
+		max: 2 * time.Minute,
+	}
+	for {
+		bot, err := sg.restClient.getGatewayBot()
+		if err == nil {
+			return bot.Shards, nil
+		}
+		wait := b.next()
+		fmt.Printf("Failed to get the recommended shard count, retrying in %v: %+v\n", wait, err)
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// updateState aggregates the state of all shards, the group is only connected
+// when all shards are
+func (sg *shardGroup) updateState() {
+	sg.Lock()
+	defer sg.Unlock()
+	state := gatewayConnected
+	if len(sg.shards) == 0 {
+		state = gatewayDisconnected
+	}
+	for _, gw := range sg.shards {
+		gw.Lock()
+		if gw.state < state {
+			state = gw.state
+		}
+		gw.Unlock()
+	}
+	if state == sg.state {
+		return
+	}
+	sg.state = state
+	publishState(sg.subscribers, state)
+}
+
+func (sg *shardGroup) connected() bool {
+	sg.Lock()
+	defer sg.Unlock()
+	return sg.state == gatewayConnected
+}
+
+// subscribe returns a channel which receives the aggregated state of the
+// shards whenever it changes
+func (sg *shardGroup) subscribe() <-chan gatewayState {
+	sg.Lock()
+	defer sg.Unlock()
+	sub := make(chan gatewayState, 1)
+	sg.subscribers = append(sg.subscribers, sub)
+	return sub
+}
+
+// updatePresence sets the presence of all shards, shards that are not
+// connected get it when they identify
+func (sg *shardGroup) updatePresence(presence opUpdatePresence) error {
+	sg.Lock()
+	sg.presence = &presence
+	shards := sg.shards
+	sg.Unlock()
+	for _, gw := range shards {
+		if !gw.connected() {
+			continue
+		}
+		if err := gw.writeJSONMessage(wsPayload{
+			OP: 3,
+			D:  presence,
+		}); err != nil {
+			return fmt.Errorf("shard %d: %w", gw.shardID, err)
+		}
+	}
+	return nil
+}
+
+func (sg *shardGroup) currentPresence() *opUpdatePresence {
+	sg.Lock()
+	defer sg.Unlock()
+	return sg.presence
+}
+
+func (sg *shardGroup) Close() {
+	sg.Lock()
+	shards := sg.shards
+	sg.Unlock()
+	for _, gw := range shards {
+		gw.Close()
+	}
+}
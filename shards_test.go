@@ -0,0 +1,77 @@
+package main
+
+import "testing"
+
+func TestParseShardCount(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int
+		err   bool
+	}{
+		{"", 1, false},
+		{"auto", 0, false},
+		{"1", 1, false},
+		{"3", 3, false},
+		{"0", 0, true},
+		{"-2", 0, true},
+		{"x", 0, true},
+		{"Auto", 0, true},
+	}
+	for _, test := range tests {
+		count, err := parseShardCount(test.value)
+		if test.err {
+			if err == nil {
+				t.Errorf("parseShardCount(%q) = %d, want an error", test.value, count)
+			}
+			continue
+		}
+		if err != nil || count != test.want {
+			t.Errorf("parseShardCount(%q) = %d, %v, want %d", test.value, count, err, test.want)
+		}
+	}
+}
+
+func TestShardGroupState(t *testing.T) {
+	tests := []struct {
+		shards []gatewayState
+		want   gatewayState
+	}{
+		{nil, gatewayDisconnected},
+		{[]gatewayState{gatewayConnected}, gatewayConnected},
+		{[]gatewayState{gatewayConnecting}, gatewayConnecting},
+		{[]gatewayState{gatewayConnected, gatewayConnected, gatewayConnected}, gatewayConnected},
+		{[]gatewayState{gatewayConnected, gatewayConnecting, gatewayConnected}, gatewayConnecting},
+		{[]gatewayState{gatewayConnected, gatewayDisconnected}, gatewayDisconnected},
+		{[]gatewayState{gatewayConnecting, gatewayDisconnected}, gatewayDisconnected},
+	}
+	for _, test := range tests {
+		sg := newShardGroup(nil, "", false, len(test.shards))
+		for _, state := range test.shards {
+			sg.shards = append(sg.shards, &gateway{state: state})
+		}
+		// Start out as something else, so that every change is published
+		sg.state = gatewayState(-1)
+		states := sg.subscribe()
+		sg.updateState()
+
+		if connected := sg.connected(); connected != (test.want == gatewayConnected) {
+			t.Errorf("shards %v: connected() = %t", test.shards, connected)
+		}
+		select {
+		case state := <-states:
+			if state != test.want {
+				t.Errorf("shards %v: published %v, want %v", test.shards, state, test.want)
+			}
+		default:
+			t.Errorf("shards %v: no state was published", test.shards)
+		}
+
+		// An unchanged state is not published again
+		sg.updateState()
+		select {
+		case state := <-states:
+			t.Errorf("shards %v: published %v again", test.shards, state)
+		default:
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// webhookName is the name of the webhook discraft creates, an existing
+// webhook with this name is reused
+const webhookName = "discraft"
+
+// defaultAvatarURL is a skin head service that accepts both names and UUIDs
+const defaultAvatarURL = "https://mc-heads.net/avatar/{{if .UUID}}{{.UUID}}{{else}}{{.Name}}{{end}}"
+
+// avatarData is what the DISCRAFT_AVATAR_URL template is rendered with
+type avatarData struct {
+	Name string // the name of the player
+	UUID string // the UUID of the player, empty if it is not known
+}
+
+// webhookRelay posts chat messages with the name and skin of the player
+// through a channel webhook
+type webhookRelay struct {
+	restClient *restClient
+	channelID  snowflake
+	avatarURL  *template.Template
+	webhook    *webhookObj // nil until the webhook has been found or created
+}
+
+func newWebhookRelay(restClient *restClient, channelID snowflake, avatarURL string) (*webhookRelay, error) {
+	if avatarURL == "" {
+		avatarURL = defaultAvatarURL
+	}
+	tmpl, err := template.New("avatar").Parse(avatarURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing avatar URL template: %w", err)
+	}
+	return &webhookRelay{
+		restClient: restClient,
+		channelID:  channelID,
+		avatarURL:  tmpl,
+	}, nil
+}
+
+// webhookSetupError is returned by send when the message was not sent because
+// the webhook could not be found or created
+type webhookSetupError struct {
+	err error
+}
+
+func (err *webhookSetupError) Error() string {
+	return fmt.Sprintf("setting up webhook: %v", err.err)
+}
+
+func (err *webhookSetupError) Unwrap() error {
+	return err.err
+}
+
+// ensure finds our webhook in the channel, or creates it
+func (wr *webhookRelay) ensure() error {
+	if wr.webhook != nil {
+		return nil
+	}
+	webhooks, err := wr.restClient.getChannelWebhooks(wr.channelID)
+	if err != nil {
+		return &webhookSetupError{fmt.Errorf("getting webhooks: %w", err)}
+	}
+	for i, webhook := range webhooks {
+		// Only incoming webhooks have a token we can execute them with
+		if webhook.Name != nil && *webhook.Name == webhookName && webhook.Token != "" {
+			wr.webhook = &webhooks[i]
+			return nil
+		}
+	}
+	webhook, err := wr.restClient.createWebhook(wr.channelID, webhookName)
+	if err != nil {
+		return &webhookSetupError{fmt.Errorf("creating webhook: %w", err)}
+	}
+	fmt.Printf("Created webhook %s in %s\n", webhook.ID, wr.channelID)
+	wr.webhook = webhook
+	return nil
+}
+
+// send posts msg as the player
+func (wr *webhookRelay) send(player avatarData, msg messageCreateParams) error {
+	if err := wr.ensure(); err != nil {
+		return err
+	}
+	var avatarURL bytes.Buffer
+	if err := wr.avatarURL.Execute(&avatarURL, player); err != nil {
+		return &webhookSetupError{fmt.Errorf("rendering avatar URL: %w", err)}
+	}
+	_, err := wr.restClient.executeWebhook(wr.webhook, webhookExecuteParams{
+		Content:         msg.Content,
+		Username:        webhookUsername(player.Name),
+		AvatarURL:       avatarURL.String(),
+		Embeds:          msg.Embeds,
+		AllowedMentions: msg.AllowedMentions,
+	})
+	var apiErr *discordAPIError
+	if errors.As(err, &apiErr) && apiErr.Code == errorCodeUnknownWebhook {
+		wr.webhook = nil // someone deleted the webhook, create it again next time
+	}
+	return err
+}
+
+// rejectedByWebhook reports whether the message given to send was certainly not
+// posted, so that it can be sent as the bot instead without posting it twice
+func rejectedByWebhook(err error) bool {
+	var setupErr *webhookSetupError
+	if errors.As(err, &setupErr) {
+		return true
+	}
+	var apiErr *discordAPIError
+	return errors.As(err, &apiErr) && apiErr.Status >= 400 && apiErr.Status < 500
+}
+
+// webhookUsername makes a player name acceptable as a webhook username, which
+// may not contain "discord" or "clyde"
+func webhookUsername(name string) string {
+	name = stripFormatting(name)
+	for _, word := range []string{"discord", "clyde"} {
+		if i := strings.Index(strings.ToLower(name), word); i >= 0 {
+			// A zero width space breaks up the word
+			name = name[:i+1] + "​" + name[i+1:]
+		}
+	}
+	return name
+}
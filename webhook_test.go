@@ -0,0 +1,25 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestRejectedByWebhook(t *testing.T) {
+	tests := []struct {
+		err      error
+		rejected bool
+	}{
+		{&webhookSetupError{errors.New("getting webhooks: connection refused")}, true},
+		{fmt.Errorf("executing webhook: %w", &discordAPIError{Status: 400, Code: 50035}), true},
+		{&discordAPIError{Status: 404, Code: errorCodeUnknownWebhook}, true},
+		{&discordAPIError{Status: 502}, false},
+		{errors.New("connection reset by peer"), false},
+	}
+	for _, test := range tests {
+		if rejected := rejectedByWebhook(test.err); rejected != test.rejected {
+			t.Errorf("rejectedByWebhook(%v) = %v, want %v", test.err, rejected, test.rejected)
+		}
+	}
+}
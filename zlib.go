@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// zlibSuffix marks the end of a complete message in a zlib-stream, see
+// https://discord.com/developers/docs/topics/gateway#transport-compression
+var zlibSuffix = []byte{0x00, 0x00, 0xff, 0xff}
+
+// zlibStream inflates the zlib-stream transport compression. All messages on a
+// connection share a single zlib context, so one inflater is kept running for
+// the whole connection and fed one complete message at a time.
+type zlibStream struct {
+	buf    []byte // frames received since the last complete message
+	frames chan []byte
+	out    chan zlibResult
+
+	// only touched by the inflater goroutine
+	pending  []byte // part of the current message not yet read by the inflater
+	awaiting bool   // whether feed is waiting for a result
+}
+
+type zlibResult struct {
+	message []byte
+	err     error
+}
+
+func newZlibStream() *zlibStream {
+	z := &zlibStream{
+		frames: make(chan []byte),
+		out:    make(chan zlibResult),
+	}
+	go z.inflate()
+	return z
+}
+
+// feed adds a received websocket frame to the stream. It returns the inflated
+// message once the frame completes one and nil otherwise.
+func (z *zlibStream) feed(frame []byte) ([]byte, error) {
+	z.buf = append(z.buf, frame...)
+	if !bytes.HasSuffix(z.buf, zlibSuffix) {
+		return nil, nil
+	}
+	compressed := z.buf
+	z.buf = nil
+
+	z.frames <- compressed
+	res := <-z.out
+	return res.message, res.err
+}
+
+// Close stops the inflater goroutine
+func (z *zlibStream) Close() {
+	close(z.frames)
+}
+
+// Read blocks until the next complete message is fed, it is only used by the
+// inflater goroutine
+func (z *zlibStream) Read(p []byte) (int, error) {
+	if len(z.pending) == 0 {
+		compressed, ok := <-z.frames
+		if !ok {
+			return 0, io.EOF
+		}
+		z.pending = compressed
+		z.awaiting = true
+	}
+	n := copy(p, z.pending)
+	z.pending = z.pending[n:]
+	return n, nil
+}
+
+func (z *zlibStream) inflate() {
+	err := z.decode()
+	// The stream is broken, answer any outstanding and future feeds with the
+	// error until the stream is closed
+	if z.awaiting {
+		z.out <- zlibResult{err: err}
+	}
+	for range z.frames {
+		z.out <- zlibResult{err: err}
+	}
+}
+
+func (z *zlibStream) decode() error {
+	zr, err := zlib.NewReader(z)
+	if err != nil {
+		return fmt.Errorf("reading zlib header: %w", err)
+	}
+	// Every flushed message is a single JSON payload
+	dec := json.NewDecoder(zr)
+	for {
+		var message json.RawMessage
+		if err := dec.Decode(&message); err != nil {
+			return fmt.Errorf("inflating message: %w", err)
+		}
+		z.awaiting = false
+		z.out <- zlibResult{message: message}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+)
+
+// Hand-made frames in the format of compress=zlib-stream: all payloads share
+// one zlib context and each ends with a Z_SYNC_FLUSH suffix. The READY payload
+// is split over two websocket frames.
+var zlibFrames = []string{
+	"789caa56ca2f50b23234d0514a51b2aa56ca484d2c2a494a4d2c89cfcc2b492d2a4bcc51b23231343235a8ad05000000ffff",
+	"2c8ecd0e82301084df65cf961ff5626f26fa02de3c350b2c4d1314d26d2584f8ee8e84ebcc373feb460254f0074a64e971bfde9eb4473f642f",
+	"3045358c6f17a0515f550d9f0144d1fc12e739c9cc8bcb11b534abdab2dc3593d5086baa4d537441db317685f788f2340da1e584d2ffcad65b1f4f70fa813dbee0daf7070000ffff",
+	"82b8cdd010ec94bcd29c9c5a00000000ffff",
+}
+
+func TestZlibStream(t *testing.T) {
+	zs := newZlibStream()
+	defer zs.Close()
+
+	var payloads []*wsPayload
+	for i, frame := range zlibFrames {
+		data, err := hex.DecodeString(frame)
+		if err != nil {
+			t.Fatalf("failed to decode frame %d: %+v", i, err)
+		}
+		message, err := zs.feed(data)
+		if err != nil {
+			t.Fatalf("failed to inflate frame %d: %+v", i, err)
+		}
+		if message == nil {
+			continue
+		}
+		payload := &wsPayload{}
+		if err := json.Unmarshal(message, payload); err != nil {
+			t.Fatalf("failed to parse message %s: %+v", message, err)
+		}
+		payloads = append(payloads, payload)
+	}
+
+	if len(payloads) != 3 {
+		t.Fatalf("Expected 3 messages, got %d", len(payloads))
+	}
+	if hello, ok := payloads[0].D.(*opHello); !ok || hello.HeartbeatInterval.Milliseconds() != 41250 {
+		t.Errorf("Expected Hello with interval 41250ms, got %T %+v", payloads[0].D, payloads[0].D)
+	}
+	if ready, ok := payloads[1].D.(*dispatchReady); !ok || ready.Session_id != "f00ba4" {
+		t.Errorf("Expected READY with session f00ba4, got %T %+v", payloads[1].D, payloads[1].D)
+	}
+	if _, ok := payloads[2].D.(*opHeartbeatACK); !ok {
+		t.Errorf("Expected Heartbeat ACK, got %T %+v", payloads[2].D, payloads[2].D)
+	}
+}
+
+func TestZlibStreamCorrupt(t *testing.T) {
+	zs := newZlibStream()
+	defer zs.Close()
+
+	for i := 0; i < 2; i++ {
+		if _, err := zs.feed([]byte{0xde, 0xad, 0x00, 0x00, 0xff, 0xff}); err == nil {
+			t.Errorf("Expected error for corrupt frame %d", i)
+		}
+	}
+}